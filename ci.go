@@ -1,14 +1,28 @@
 package orchestrator
 
+import configuration "github.com/diggerhq/lib-digger-config"
+
+// PullRequestService is implemented by each CI provider. Adding a method breaks implementations outside this module,
+// e.g. GitLab: FindCommentByMarker, SetJobStatus, MergePullRequest, GetLatestCommitSHA,
+// GetMergedPullRequestChangedFiles, GetPullRequestBody and UpsertSummaryComment were added and must be implemented
+// there too
 type PullRequestService interface {
 	GetChangedFiles(prNumber int) ([]string, error)
+	// GetMergedPullRequestChangedFiles returns the files changed by the commit a merged pull/merge request landed with
+	GetMergedPullRequestChangedFiles(prNumber int) ([]string, error)
 	PublishComment(prNumber int, comment string) error
 	EditComment(prNumber int, id interface{}, comment string) error
 	GetComments(prNumber int) ([]Comment, error)
-	// SetStatus set status of specified pull/merge request, status could be: "pending", "failure", "success"
+	// FindCommentByMarker returns the comment containing the given hidden marker, or nil if none matches
+	FindCommentByMarker(prNumber int, marker string) (*Comment, error)
+	// SetStatus set status of specified pull/merge request, status could be: "pending", "failure", "success".
+	// statusContext should be built with StatusContext so that required checks can be configured by name
 	SetStatus(prNumber int, status string, statusContext string) error
+	// SetJobStatus set status of specified pull/merge request from a semantic job status, translating it to the provider state and description
+	SetJobStatus(prNumber int, status JobStatus, statusContext string) error
 	GetCombinedPullRequestStatus(prNumber int) (string, error)
-	MergePullRequest(prNumber int) error
+	// MergePullRequest merges the pull/merge request, commitTitle defaults to the pull request title when empty
+	MergePullRequest(prNumber int, commitTitle string, commitMessage string) error
 	// IsMergeable is still open and ready to be merged
 	IsMergeable(prNumber int) (bool, error)
 	// IsMerged merged and closed
@@ -16,6 +30,18 @@ type PullRequestService interface {
 	// IsClosed closed without merging
 	IsClosed(prNumber int) (bool, error)
 	GetBranchName(prNumber int) (string, error)
+	// GetPullRequestBody returns the description of the pull/merge request
+	GetPullRequestBody(prNumber int) (string, error)
+	// GetLatestCommitSHA returns the SHA of the pull/merge request head commit
+	GetLatestCommitSHA(prNumber int) (string, error)
+	// UpsertSummaryComment creates or edits the comment summarizing the status of all projects, see FormatSummary
+	UpsertSummaryComment(prNumber int, summary SummaryData) (int64, error)
+}
+
+// EventConverter converts the events of a CI provider to jobs. It returns whether the jobs cover all impacted projects,
+// which isn't the case when a comment targets a single project.
+type EventConverter interface {
+	ConvertToJobs(event interface{}, impactedProjects []configuration.Project, requestedProject *configuration.Project, workflows map[string]configuration.Workflow) ([]Job, bool, error)
 }
 
 type OrgService interface {
@@ -26,3 +52,28 @@ type Comment struct {
 	Id   interface{}
 	Body *string
 }
+
+type Reaction struct {
+	Id interface{}
+	// User is the login of the user who reacted
+	User string
+	// Content is the reaction type, e.g. "+1", "rocket", "eyes"
+	Content string
+}
+
+// FilePatch is a file changed by a pull request with its diff
+type FilePatch struct {
+	// Filename uses forward slashes regardless of the platform
+	Filename string
+	// Status is the kind of change, e.g. "added", "modified", "removed", "renamed"
+	Status string
+	// Patch holds the unified diff hunks of the file, it is empty for binary files and diffs too large to be returned
+	Patch string
+}
+
+// Repository identifies a repository, e.g. one the CI provider app is installed on
+type Repository struct {
+	Owner         string
+	Name          string
+	DefaultBranch string
+}
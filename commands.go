@@ -0,0 +1,67 @@
+package orchestrator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CommandRegistry maps the commands that can be commented on pull requests, e.g. "digger plan", to the action of the
+// jobs they generate. Custom commands, e.g. "digger test", run terraform unless registered with another action and
+// the runner dispatches them by name. See DefaultCommandRegistry for the built-in commands.
+type CommandRegistry map[string]JobAction
+
+// DefaultCommandRegistry returns a new registry of the built-in commands, consumers may add their own commands to it
+func DefaultCommandRegistry() CommandRegistry {
+	return CommandRegistry{
+		"digger plan":   JobActionTerraform,
+		"digger apply":  JobActionTerraform,
+		"digger lock":   JobActionLock,
+		"digger unlock": JobActionUnlock,
+	}
+}
+
+// Match returns the registered command a comment starts with, ignoring case. The longest command wins so that e.g.
+// "digger plan-destroy" isn't matched as "digger plan" when both are registered.
+func (r CommandRegistry) Match(comment string) (string, bool) {
+	comment = strings.ToLower(strings.TrimSpace(comment))
+	match := ""
+	for command := range r {
+		command = strings.ToLower(command)
+		if strings.HasPrefix(comment, command) && len(command) > len(match) {
+			match = command
+		}
+	}
+	return match, match != ""
+}
+
+// Action returns the action of a command, commands that aren't registered fall back to CommandAction
+func (r CommandRegistry) Action(command string) JobAction {
+	command = strings.ToLower(strings.TrimSpace(command))
+	for registered, action := range r {
+		if strings.ToLower(registered) == command {
+			return action
+		}
+	}
+	return CommandAction(command)
+}
+
+// Commands returns the registered commands in alphabetical order
+func (r CommandRegistry) Commands() []string {
+	commands := make([]string, 0, len(r))
+	for command := range r {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+	return commands
+}
+
+// Help renders the registered commands as a markdown list, e.g. for the reply to "digger help"
+func (r CommandRegistry) Help() string {
+	var builder strings.Builder
+	builder.WriteString("Available commands:\n")
+	for _, command := range r.Commands() {
+		fmt.Fprintf(&builder, "- `%v`\n", command)
+	}
+	return builder.String()
+}
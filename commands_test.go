@@ -0,0 +1,32 @@
+package orchestrator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandRegistryMatch(t *testing.T) {
+	registry := DefaultCommandRegistry()
+	registry["digger plan-destroy"] = JobActionTerraform
+
+	command, ok := registry.Match("  Digger Plan -p dev")
+	assert.True(t, ok)
+	assert.Equal(t, "digger plan", command)
+
+	command, ok = registry.Match("digger plan-destroy -p dev")
+	assert.True(t, ok)
+	assert.Equal(t, "digger plan-destroy", command)
+
+	_, ok = registry.Match("digger test")
+	assert.False(t, ok)
+
+	assert.Equal(t, JobActionUnlock, registry.Action("digger unlock"))
+	assert.Equal(t, JobActionTerraform, registry.Action("digger plan-destroy"))
+}
+
+func TestCommandRegistryHelp(t *testing.T) {
+	registry := CommandRegistry{"digger test": JobActionTerraform, "digger plan": JobActionTerraform}
+	assert.Equal(t, []string{"digger plan", "digger test"}, registry.Commands())
+	assert.Equal(t, "Available commands:\n- `digger plan`\n- `digger test`\n", registry.Help())
+}
@@ -0,0 +1,100 @@
+package orchestrator
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+type CommentFormatOptions struct {
+	// StripANSI removes the color codes of command output, for output produced without -no-color
+	StripANSI bool
+}
+
+// FormatPlanOutput wraps plan output in a code block, ready to be posted with PublishComment
+func FormatPlanOutput(planOutput string, opts CommentFormatOptions) string {
+	if opts.StripANSI {
+		planOutput = StripANSI(planOutput)
+	}
+	return fmt.Sprintf("```terraform\n%v\n```", strings.TrimRight(planOutput, "\n"))
+}
+
+// CommentData is passed to comment templates
+type CommentData struct {
+	ProjectName string
+	// Command is the command without the "digger" prefix, e.g. "plan"
+	Command   string
+	Workspace string
+	Body      string
+}
+
+const DefaultCommentTemplateText = `### Digger {{ capitalize .Command }} for project {{ .ProjectName }}{{ if .Workspace }} (workspace {{ .Workspace }}){{ end }}
+
+{{ .Body }}
+
+<sub>Posted by digger</sub>`
+
+var commentTemplateFuncs = template.FuncMap{
+	"capitalize": func(s string) string {
+		if s == "" {
+			return s
+		}
+		return strings.ToUpper(s[:1]) + s[1:]
+	},
+}
+
+// DefaultCommentTemplate is used by FormatComment when no template is given
+var DefaultCommentTemplate = template.Must(NewCommentTemplate(DefaultCommentTemplateText))
+
+// NewCommentTemplate parses a custom comment template, which can use the fields of CommentData and the "capitalize"
+// function
+func NewCommentTemplate(text string) (*template.Template, error) {
+	return template.New("comment").Funcs(commentTemplateFuncs).Parse(text)
+}
+
+// FormatComment renders the header and footer of tmpl around data.Body, DefaultCommentTemplate is used if tmpl is nil
+func FormatComment(tmpl *template.Template, data CommentData) (string, error) {
+	if tmpl == nil {
+		tmpl = DefaultCommentTemplate
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("error formatting comment: %v", err)
+	}
+	return sb.String(), nil
+}
+
+// SummaryCommentMarker identifies the summary comment maintained by UpsertSummaryComment
+const SummaryCommentMarker = "<!-- digger-summary -->"
+
+// SummaryRow is the status of a command run for one project
+type SummaryRow struct {
+	ProjectName string
+	// Command is the command run, e.g. "digger plan"
+	Command string
+	Status  JobStatus
+	// Link points to the details of the run, e.g. the CI job or the plan comment, it can be empty
+	Link string
+}
+
+// SummaryData is filled by runners to summarize the commands run for all projects of a pull request in one comment
+type SummaryData struct {
+	Rows []SummaryRow
+}
+
+// FormatSummary renders summary as a markdown table with one row per project, marked with SummaryCommentMarker
+func FormatSummary(summary SummaryData) string {
+	var sb strings.Builder
+	sb.WriteString(SummaryCommentMarker + "\n")
+	sb.WriteString("### Digger summary\n\n")
+	sb.WriteString("| Project | Command | Status | Details |\n")
+	sb.WriteString("|---------|---------|--------|---------|\n")
+	for _, row := range summary.Rows {
+		link := ""
+		if row.Link != "" {
+			link = fmt.Sprintf("[details](%v)", row.Link)
+		}
+		fmt.Fprintf(&sb, "| %v | `%v` | %v | %v |\n", row.ProjectName, strings.TrimSpace(row.Command), row.Status.Description(), link)
+	}
+	return sb.String()
+}
@@ -0,0 +1,37 @@
+package orchestrator
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFormatPlanOutput(t *testing.T) {
+	output := "\x1b[1mPlan:\x1b[0m 1 to add, 0 to change, 0 to destroy.\n"
+	assert.Equal(t, "```terraform\nPlan: 1 to add, 0 to change, 0 to destroy.\n```", FormatPlanOutput(output, CommentFormatOptions{StripANSI: true}))
+	assert.Equal(t, "```terraform\n\x1b[1mPlan:\x1b[0m 1 to add, 0 to change, 0 to destroy.\n```", FormatPlanOutput(output, CommentFormatOptions{}))
+}
+
+func TestFormatComment(t *testing.T) {
+	data := CommentData{ProjectName: "dev", Command: "plan", Workspace: "staging", Body: "No changes."}
+	comment, err := FormatComment(nil, data)
+	assert.NoError(t, err)
+	assert.Equal(t, "### Digger Plan for project dev (workspace staging)\n\nNo changes.\n\n<sub>Posted by digger</sub>", comment)
+
+	tmpl, err := NewCommentTemplate("**{{ .ProjectName }}** {{ .Command }}: {{ .Body }}")
+	assert.NoError(t, err)
+	comment, err = FormatComment(tmpl, data)
+	assert.NoError(t, err)
+	assert.Equal(t, "**dev** plan: No changes.", comment)
+}
+
+func TestFormatSummary(t *testing.T) {
+	summary := FormatSummary(SummaryData{Rows: []SummaryRow{
+		{ProjectName: "dev", Command: "digger plan", Status: PlanSucceeded, Link: "https://ci.example.com/runs/1"},
+		{ProjectName: "prod", Command: "digger plan", Status: PlanPending},
+	}})
+	assert.Equal(t, SummaryCommentMarker+"\n### Digger summary\n\n"+
+		"| Project | Command | Status | Details |\n"+
+		"|---------|---------|--------|---------|\n"+
+		"| dev | `digger plan` | Plan succeeded | [details](https://ci.example.com/runs/1) |\n"+
+		"| prod | `digger plan` | Plan in progress |  |\n", summary)
+}
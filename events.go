@@ -0,0 +1,50 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnsupportedEvent is returned for events that can't be converted to jobs, callers may ignore such events rather
+// than fail
+var ErrUnsupportedEvent = errors.New("unsupported event type")
+
+// EventType is the kind of CI event a run was triggered by
+type EventType int
+
+const (
+	EventUnsupported EventType = iota
+	EventPullRequest
+	EventIssueComment
+	EventPush
+	EventSchedule
+	EventWorkflowDispatch
+	EventPullRequestReview
+	EventPullRequestTarget
+	EventPullRequestReviewComment
+)
+
+// String returns the event name used by GitHub, e.g. "pull_request", which is also the EventName of jobs
+func (t EventType) String() string {
+	switch t {
+	case EventPullRequest:
+		return "pull_request"
+	case EventIssueComment:
+		return "issue_comment"
+	case EventPush:
+		return "push"
+	case EventSchedule:
+		return "schedule"
+	case EventWorkflowDispatch:
+		return "workflow_dispatch"
+	case EventPullRequestReview:
+		return "pull_request_review"
+	case EventPullRequestTarget:
+		return "pull_request_target"
+	case EventPullRequestReviewComment:
+		return "pull_request_review_comment"
+	case EventUnsupported:
+		return "unsupported"
+	}
+	return fmt.Sprintf("unknown event type %d", int(t))
+}
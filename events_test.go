@@ -0,0 +1,16 @@
+package orchestrator
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEventTypeString(t *testing.T) {
+	assert.Equal(t, "pull_request", EventPullRequest.String())
+	assert.Equal(t, "issue_comment", EventIssueComment.String())
+	assert.Equal(t, "workflow_dispatch", EventWorkflowDispatch.String())
+	assert.Equal(t, "pull_request_target", EventPullRequestTarget.String())
+	assert.Equal(t, "pull_request_review_comment", EventPullRequestReviewComment.String())
+	assert.Equal(t, "unsupported", EventUnsupported.String())
+	assert.Equal(t, "unknown event type 42", EventType(42).String())
+}
@@ -0,0 +1,38 @@
+package github
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrCommandDenied = errors.New("not allowed to run digger commands")
+
+// CommandAccess restricts the users who may run commands by commenting, a simpler alternative to team lookups for
+// small organisations. Logins are compared ignoring case.
+type CommandAccess struct {
+	// Allow are the only users allowed to run commands when it isn't empty
+	Allow []string
+	// Deny are users never allowed to run commands, even when they are in Allow
+	Deny []string
+}
+
+// Check returns an error wrapping ErrCommandDenied when user, e.g. the actor of the event, may not run commands
+func (a CommandAccess) Check(user string) error {
+	if containsLogin(a.Deny, user) {
+		return fmt.Errorf("user %v is %w, they are in the denylist", user, ErrCommandDenied)
+	}
+	if len(a.Allow) > 0 && !containsLogin(a.Allow, user) {
+		return fmt.Errorf("user %v is %w, they aren't in the allowlist", user, ErrCommandDenied)
+	}
+	return nil
+}
+
+func containsLogin(logins []string, login string) bool {
+	for _, l := range logins {
+		if strings.EqualFold(strings.TrimSpace(l), login) {
+			return true
+		}
+	}
+	return false
+}
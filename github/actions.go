@@ -0,0 +1,15 @@
+package github
+
+import "fmt"
+
+// GetWorkflowRunURL returns the web page of a GitHub Actions run, e.g. of the current run given by $GITHUB_RUN_ID to
+// link to it as the TargetURL of statuses or in comment footers. The token needs the actions:read permission.
+func (svc *GithubService) GetWorkflowRunURL(runID int64) (string, error) {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	run, _, err := svc.Client.Actions.GetWorkflowRunByID(ctx, svc.Owner, svc.RepoName, runID)
+	if err != nil {
+		return "", fmt.Errorf("error getting workflow run %d: %w", runID, checkPermissions(err))
+	}
+	return run.GetHTMLURL(), nil
+}
@@ -0,0 +1,35 @@
+package github
+
+import (
+	"fmt"
+
+	orchestrator "github.com/diggerhq/lib-orchestrator"
+	"github.com/google/go-github/v55/github"
+)
+
+// ListInstallationRepositories lists the repositories accessible to the GitHub App installation the service is
+// authenticated as, e.g. to discover the repositories to watch. It requires an installation token, see
+// NewGitHubServiceWithTokenSource. The Owner and RepoName of the service are ignored.
+func (svc *GithubService) ListInstallationRepositories() ([]orchestrator.Repository, error) {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	var repositories []orchestrator.Repository
+	opts := &github.ListOptions{PerPage: svc.perPage()}
+	for {
+		page, resp, err := svc.Client.Apps.ListRepos(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("error listing installation repositories: %w", checkPermissions(err))
+		}
+		for _, repository := range page.Repositories {
+			repositories = append(repositories, orchestrator.Repository{
+				Owner:         repository.GetOwner().GetLogin(),
+				Name:          repository.GetName(),
+				DefaultBranch: repository.GetDefaultBranch(),
+			})
+		}
+		if resp.NextPage == 0 {
+			return repositories, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
@@ -0,0 +1,71 @@
+package github
+
+import (
+	"fmt"
+	"log"
+
+	configuration "github.com/diggerhq/lib-digger-config"
+	orchestrator "github.com/diggerhq/lib-orchestrator"
+	"github.com/google/go-github/v55/github"
+)
+
+// AutoApply configures applying the projects of a pull request right after they are planned on push, e.g. for
+// non-production environments. It is disabled by default.
+type AutoApply struct {
+	Enabled bool
+	// Projects are the names of the projects applied automatically, all projects when empty
+	Projects []string
+	// AuthorizeApply tells whether the user who pushed may apply, pushes are only planned when it isn't set or the
+	// user isn't authorized
+	AuthorizeApply func(user string) (bool, error)
+}
+
+// ConvertGithubPullRequestEventToJobsWithAutoApply is ConvertGithubPullRequestEventToJobs running "digger apply"
+// after the plan of the projects selected by autoApply when a pull request is opened, reopened or pushed to
+func ConvertGithubPullRequestEventToJobsWithAutoApply(payload *github.PullRequestEvent, impactedProjects []configuration.Project, requestedProject *configuration.Project, workflows map[string]configuration.Workflow, autoApply AutoApply) ([]orchestrator.Job, bool, error) {
+	jobs, coversAllImpactedProjects, err := ConvertGithubPullRequestEventToJobs(payload, impactedProjects, requestedProject, workflows)
+	if err != nil || !autoApply.Enabled {
+		return jobs, coversAllImpactedProjects, err
+	}
+	switch payload.GetAction() {
+	case "opened", "reopened", "synchronize":
+	default:
+		return jobs, coversAllImpactedProjects, nil
+	}
+
+	user := payload.GetSender().GetLogin()
+	if autoApply.AuthorizeApply == nil {
+		log.Printf("not applying PR #%d automatically, apply authorization isn't configured", payload.GetPullRequest().GetNumber())
+		return jobs, coversAllImpactedProjects, nil
+	}
+	authorized, err := autoApply.AuthorizeApply(user)
+	if err != nil {
+		return nil, false, fmt.Errorf("error authorizing auto apply: %v", err)
+	}
+	if !authorized {
+		log.Printf("not applying PR #%d automatically, user %v is not allowed to apply", payload.GetPullRequest().GetNumber(), user)
+		return jobs, coversAllImpactedProjects, nil
+	}
+
+	for i := range jobs {
+		if !autoApply.appliesTo(jobs[i].ProjectName) || !containsCommand(jobs[i].Commands, "digger plan") || containsCommand(jobs[i].Commands, "digger apply") {
+			continue
+		}
+		// the commands slice is shared with the workflow configuration
+		jobs[i].Commands = append(append([]string{}, jobs[i].Commands...), "digger apply")
+		jobs[i].Action = orchestrator.JobActionForCommands(jobs[i].Commands)
+	}
+	return jobs, coversAllImpactedProjects, nil
+}
+
+func (a AutoApply) appliesTo(project string) bool {
+	if len(a.Projects) == 0 {
+		return true
+	}
+	for _, name := range a.Projects {
+		if name == project {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package github
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+const enableAutoMergeMutation = `mutation($pullRequestId: ID!, $mergeMethod: PullRequestMergeMethod!, $commitHeadline: String, $commitBody: String) {
+  enablePullRequestAutoMerge(input: {pullRequestId: $pullRequestId, mergeMethod: $mergeMethod, commitHeadline: $commitHeadline, commitBody: $commitBody}) {
+    clientMutationId
+  }
+}`
+
+// EnableAutoMerge makes GitHub merge the pull request once its requirements are met, through the merge queue when
+// the base branch requires one. mergeMethod is "merge", "squash" or "rebase".
+func (svc *GithubService) EnableAutoMerge(prNumber int, mergeMethod string) error {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	pr, _, err := svc.Client.PullRequests.Get(ctx, svc.Owner, svc.RepoName, prNumber)
+	if err != nil {
+		return fmt.Errorf("error getting pull request: %w", checkPermissions(err))
+	}
+	return svc.enableAutoMerge(pr, mergeMethod, "", "")
+}
+
+// enableAutoMerge enables auto-merge of pr, an empty commitHeadline or commitBody keeps GitHub's default
+func (svc *GithubService) enableAutoMerge(pr *github.PullRequest, mergeMethod string, commitHeadline string, commitBody string) error {
+	switch mergeMethod {
+	case "merge", "squash", "rebase":
+	default:
+		return fmt.Errorf("unsupported merge method %q, expected merge, squash or rebase", mergeMethod)
+	}
+	variables := map[string]interface{}{
+		"pullRequestId": pr.GetNodeID(),
+		"mergeMethod":   strings.ToUpper(mergeMethod),
+	}
+	if commitHeadline != "" {
+		variables["commitHeadline"] = commitHeadline
+	}
+	if commitBody != "" {
+		variables["commitBody"] = commitBody
+	}
+	if err := svc.graphQL(enableAutoMergeMutation, variables, nil); err != nil {
+		return fmt.Errorf("error enabling auto-merge of pull request %d: %v", pr.GetNumber(), err)
+	}
+	return nil
+}
+
+// isMergeQueueRequired tells whether a merge was rejected because the base branch only accepts changes through the
+// merge queue
+func isMergeQueueRequired(err error) bool {
+	var errorResponse *github.ErrorResponse
+	if !errors.As(err, &errorResponse) || errorResponse.Response == nil {
+		return false
+	}
+	statusCode := errorResponse.Response.StatusCode
+	return (statusCode == http.StatusMethodNotAllowed || statusCode == http.StatusUnprocessableEntity) &&
+		strings.Contains(strings.ToLower(errorResponse.Message), "merge queue")
+}
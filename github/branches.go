@@ -0,0 +1,227 @@
+package github
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// IsBranchUpToDate reports whether the pull request head contains every commit of its base branch. A head that is
+// behind the base, or diverged from it (both ahead and behind), is not up to date and should be updated before apply.
+func (svc *GithubService) IsBranchUpToDate(prNumber int) (bool, error) {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	pr, _, err := svc.Client.PullRequests.Get(ctx, svc.Owner, svc.RepoName, prNumber)
+	if err != nil {
+		return false, fmt.Errorf("error getting pull request: %w", checkPermissions(err))
+	}
+
+	comparison, _, err := svc.Client.Repositories.CompareCommits(ctx, svc.Owner, svc.RepoName, pr.GetBase().GetRef(), pr.GetHead().GetSHA(), nil)
+	if err != nil {
+		return false, fmt.Errorf("error comparing %v with %v: %w", pr.GetBase().GetRef(), pr.GetHead().GetSHA(), checkPermissions(err))
+	}
+
+	switch comparison.GetStatus() {
+	case "identical", "ahead":
+		return true, nil
+	case "behind", "diverged":
+		return false, nil
+	}
+	return comparison.GetBehindBy() == 0, nil
+}
+
+var ErrUpdateBranchMergeConflict = errors.New("pull request branch can't be updated because of a merge conflict")
+
+// UpdatePullRequestBranch merges the latest base branch into the pull request branch, like the "Update branch" button.
+// GitHub performs the update asynchronously, so the head may still be stale right after this returns. Conflicts with
+// the base branch are reported as ErrUpdateBranchMergeConflict.
+func (svc *GithubService) UpdatePullRequestBranch(prNumber int) error {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	_, _, err := svc.Client.PullRequests.UpdateBranch(ctx, svc.Owner, svc.RepoName, prNumber, nil)
+	if err == nil {
+		return nil
+	}
+
+	var acceptedErr *github.AcceptedError
+	if errors.As(err, &acceptedErr) {
+		// 202 Accepted, the update has been scheduled
+		return nil
+	}
+	var errorResponse *github.ErrorResponse
+	if errors.As(err, &errorResponse) && errorResponse.Response != nil && errorResponse.Response.StatusCode == http.StatusUnprocessableEntity &&
+		strings.Contains(strings.ToLower(errorResponse.Message), "conflict") {
+		return fmt.Errorf("%w: %v", ErrUpdateBranchMergeConflict, errorResponse.Message)
+	}
+	return fmt.Errorf("error updating pull request branch: %w", checkPermissions(err))
+}
+
+// GetMergeBaseSHA returns the SHA of the commit head forked from base, diffing head against it gives the changes
+// made on head only, even after base moved on
+func (svc *GithubService) GetMergeBaseSHA(base string, head string) (string, error) {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	comparison, resp, err := svc.Client.Repositories.CompareCommits(ctx, svc.Owner, svc.RepoName, base, head, nil)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return "", fmt.Errorf("no merge base between %v and %v, they may be unrelated: %w", base, head, err)
+		}
+		return "", fmt.Errorf("error comparing %v with %v: %w", base, head, checkPermissions(err))
+	}
+	// unrelated histories have no merge base commit
+	mergeBaseSHA := comparison.GetMergeBaseCommit().GetSHA()
+	if mergeBaseSHA == "" {
+		return "", fmt.Errorf("no merge base between %v and %v, they are unrelated", base, head)
+	}
+	return mergeBaseSHA, nil
+}
+
+// GetRequiredApprovingReviewCount returns the number of approvals the branch protection of branch requires before
+// merging, 0 when the branch isn't protected or doesn't require reviews. Reading branch protection needs the
+// administration:read permission, and rulesets aren't taken into account, see GetRulesForBranch.
+func (svc *GithubService) GetRequiredApprovingReviewCount(branch string) (int, error) {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	protection, _, err := svc.Client.Repositories.GetBranchProtection(ctx, svc.Owner, svc.RepoName, branch)
+	if errors.Is(err, github.ErrBranchNotProtected) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error getting protection of branch %v: %w", branch, checkPermissions(err))
+	}
+	reviews := protection.GetRequiredPullRequestReviews()
+	if reviews == nil {
+		return 0, nil
+	}
+	return reviews.RequiredApprovingReviewCount, nil
+}
+
+// HasRequiredApprovals reports whether a pull request has as many approvals as the rulesets and protection of its base
+// branch require. Only the latest review of each reviewer counts, an approval followed by a change request doesn't.
+func (svc *GithubService) HasRequiredApprovals(prNumber int) (bool, error) {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	pr, _, err := svc.Client.PullRequests.Get(ctx, svc.Owner, svc.RepoName, prNumber)
+	if err != nil {
+		return false, fmt.Errorf("error getting pull request: %w", checkPermissions(err))
+	}
+	rules, err := svc.GetRulesForBranch(pr.GetBase().GetRef())
+	if err != nil {
+		return false, err
+	}
+	required := rules.RequiredApprovingReviewCount
+	if required == 0 {
+		return true, nil
+	}
+
+	// reviews are listed in chronological order
+	latestStates := make(map[string]string)
+	opts := &github.ListOptions{PerPage: svc.perPage()}
+	for {
+		reviews, resp, err := svc.Client.PullRequests.ListReviews(ctx, svc.Owner, svc.RepoName, prNumber, opts)
+		if err != nil {
+			return false, fmt.Errorf("error listing reviews of PR #%d: %w", prNumber, checkPermissions(err))
+		}
+		for _, review := range reviews {
+			// comments don't change the verdict of a reviewer
+			if strings.ToUpper(review.GetState()) == "COMMENTED" {
+				continue
+			}
+			latestStates[review.GetUser().GetLogin()] = strings.ToUpper(review.GetState())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	approvals := 0
+	for _, state := range latestStates {
+		if state == "APPROVED" {
+			approvals++
+		}
+	}
+	return approvals >= required, nil
+}
+
+// BranchRules are the requirements to merge into a branch, combined from its rulesets and classic branch protection
+type BranchRules struct {
+	// RequiredApprovingReviewCount is the highest number of approvals required by the rules
+	RequiredApprovingReviewCount int
+	// RequiredStatusChecks are the contexts of the required status checks, sorted
+	RequiredStatusChecks []string
+}
+
+// GetRulesForBranch returns the merge requirements of branch from the rulesets applying to it, repository and
+// organisation ones, and from its classic branch protection. Newer repositories often only use rulesets, which any
+// token able to read the repository can read. Classic protection is skipped when the token lacks the
+// administration:read permission it needs.
+func (svc *GithubService) GetRulesForBranch(branch string) (BranchRules, error) {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	var rules BranchRules
+	checks := make(map[string]bool)
+
+	repositoryRules, resp, err := svc.Client.Repositories.GetRulesForBranch(ctx, svc.Owner, svc.RepoName, branch)
+	// GitHub Enterprise Server versions without rulesets don't know the endpoint
+	if err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound) {
+		return BranchRules{}, fmt.Errorf("error getting rules of branch %v: %w", branch, checkPermissions(err))
+	}
+	for _, rule := range repositoryRules {
+		if rule.Parameters == nil {
+			continue
+		}
+		switch rule.Type {
+		case "pull_request":
+			var params github.PullRequestRuleParameters
+			if err := json.Unmarshal(*rule.Parameters, &params); err != nil {
+				return BranchRules{}, fmt.Errorf("error decoding pull request rule of branch %v: %v", branch, err)
+			}
+			if params.RequiredApprovingReviewCount > rules.RequiredApprovingReviewCount {
+				rules.RequiredApprovingReviewCount = params.RequiredApprovingReviewCount
+			}
+		case "required_status_checks":
+			var params github.RequiredStatusChecksRuleParameters
+			if err := json.Unmarshal(*rule.Parameters, &params); err != nil {
+				return BranchRules{}, fmt.Errorf("error decoding required status checks rule of branch %v: %v", branch, err)
+			}
+			for _, check := range params.RequiredStatusChecks {
+				checks[check.Context] = true
+			}
+		}
+	}
+
+	protection, _, err := svc.Client.Repositories.GetBranchProtection(ctx, svc.Owner, svc.RepoName, branch)
+	err = checkPermissions(err)
+	switch {
+	case errors.Is(err, github.ErrBranchNotProtected):
+	case errors.Is(err, ErrInsufficientPermissions):
+		log.Printf("ignoring classic protection of branch %v: %v", branch, err)
+	case err != nil:
+		return BranchRules{}, fmt.Errorf("error getting protection of branch %v: %w", branch, err)
+	default:
+		if reviews := protection.GetRequiredPullRequestReviews(); reviews != nil && reviews.RequiredApprovingReviewCount > rules.RequiredApprovingReviewCount {
+			rules.RequiredApprovingReviewCount = reviews.RequiredApprovingReviewCount
+		}
+		if statusChecks := protection.GetRequiredStatusChecks(); statusChecks != nil {
+			for _, context := range statusChecks.Contexts {
+				checks[context] = true
+			}
+			for _, check := range statusChecks.Checks {
+				checks[check.Context] = true
+			}
+		}
+	}
+
+	for context := range checks {
+		rules.RequiredStatusChecks = append(rules.RequiredStatusChecks, context)
+	}
+	sort.Strings(rules.RequiredStatusChecks)
+	return rules, nil
+}
@@ -0,0 +1,67 @@
+package github
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// ListCheckRunsForRef returns all check runs of a commit, whoever created them
+func (svc *GithubService) ListCheckRunsForRef(sha string) ([]*github.CheckRun, error) {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	var checkRuns []*github.CheckRun
+	opts := &github.ListCheckRunsOptions{ListOptions: github.ListOptions{PerPage: svc.perPage()}}
+	for {
+		page, resp, err := svc.Client.Checks.ListCheckRunsForRef(ctx, svc.Owner, svc.RepoName, sha, opts)
+		if err != nil {
+			return nil, fmt.Errorf("error listing check runs of %v: %w", sha, checkPermissions(err))
+		}
+		checkRuns = append(checkRuns, page.CheckRuns...)
+		if resp.NextPage == 0 {
+			return checkRuns, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// UpdateCheckRun updates a check run created by the same GitHub App, opts.Name is required by the API
+func (svc *GithubService) UpdateCheckRun(id int64, opts github.UpdateCheckRunOptions) error {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	_, _, err := svc.Client.Checks.UpdateCheckRun(ctx, svc.Owner, svc.RepoName, id, opts)
+	if err != nil {
+		return fmt.Errorf("error updating check run %d: %w", id, checkPermissions(err))
+	}
+	return nil
+}
+
+// CancelCheckRuns marks the check runs of a commit that are still queued or in progress as cancelled, e.g. the plan
+// of a commit superseded by a new push. Only check runs whose name starts with namePrefix are touched, so that the
+// checks of other tools are left alone. Returns the number of cancelled check runs.
+func (svc *GithubService) CancelCheckRuns(sha string, namePrefix string) (int, error) {
+	if namePrefix == "" {
+		return 0, fmt.Errorf("check run name prefix is empty")
+	}
+	checkRuns, err := svc.ListCheckRunsForRef(sha)
+	if err != nil {
+		return 0, err
+	}
+	cancelled := 0
+	for _, checkRun := range checkRuns {
+		if !strings.HasPrefix(checkRun.GetName(), namePrefix) || checkRun.GetStatus() == "completed" {
+			continue
+		}
+		err := svc.UpdateCheckRun(checkRun.GetID(), github.UpdateCheckRunOptions{
+			Name:       checkRun.GetName(),
+			Status:     github.String("completed"),
+			Conclusion: github.String("cancelled"),
+		})
+		if err != nil {
+			return cancelled, err
+		}
+		cancelled++
+	}
+	return cancelled, nil
+}
@@ -0,0 +1,41 @@
+package github
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// PutFileContent commits content to the file at path on branch, e.g. to keep plan outputs for audit, creating the
+// file or updating it when it exists. It returns the SHA of the commit.
+func (svc *GithubService) PutFileContent(branch string, path string, content string, message string) (string, error) {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	opts := &github.RepositoryContentFileOptions{
+		Message: &message,
+		Content: []byte(content),
+		Branch:  &branch,
+	}
+
+	existing, _, resp, err := svc.Client.Repositories.GetContents(ctx, svc.Owner, svc.RepoName, path, &github.RepositoryContentGetOptions{Ref: branch})
+	if err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound) {
+		return "", fmt.Errorf("error getting %v on branch %v: %w", path, branch, checkPermissions(err))
+	}
+	if err == nil && existing == nil {
+		return "", fmt.Errorf("%v on branch %v is a directory", path, branch)
+	}
+
+	var result *github.RepositoryContentResponse
+	if existing == nil {
+		result, _, err = svc.Client.Repositories.CreateFile(ctx, svc.Owner, svc.RepoName, path, opts)
+	} else {
+		// updates must name the blob they replace
+		opts.SHA = existing.SHA
+		result, _, err = svc.Client.Repositories.UpdateFile(ctx, svc.Owner, svc.RepoName, path, opts)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error writing %v on branch %v: %w", path, branch, checkPermissions(err))
+	}
+	return result.Commit.GetSHA(), nil
+}
@@ -0,0 +1,175 @@
+package github
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	configuration "github.com/diggerhq/lib-digger-config"
+	orchestrator "github.com/diggerhq/lib-orchestrator"
+	"github.com/google/go-github/v55/github"
+)
+
+// EventConverter is the orchestrator.EventConverter of GitHub events, given as go-github events or pointers to them
+type EventConverter struct {
+	// LabelTriggers configures the labels converted by ConvertGithubPullRequestLabelEventToJobs
+	LabelTriggers LabelTriggers
+	// ReviewTriggers configures the reviews converted by ConvertGithubPullRequestReviewEventToJobs
+	ReviewTriggers ReviewTriggers
+	// AutoApply applies projects right after their plan on push when enabled, see
+	// ConvertGithubPullRequestEventToJobsWithAutoApply
+	AutoApply AutoApply
+	// Environments are the environments allowed in the "environment" input of workflow_dispatch runs, see
+	// ConvertGithubWorkflowDispatchEventToJobs
+	Environments map[string]Environment
+	// Commands are the commands converted from comments, defaults to orchestrator.DefaultCommandRegistry
+	Commands orchestrator.CommandRegistry
+	// FallbackWorkflow replaces the missing workflows of projects when set, see orchestrator.WithFallbackWorkflow
+	FallbackWorkflow string
+	// HasSuccessfulPlan, e.g. GithubService.HasSuccessfulPlan, is checked for every project applied by a comment when
+	// set, applying a project without a successful plan of the pull request head fails with ErrPlanRequired
+	HasSuccessfulPlan func(prNumber int, project string) (bool, error)
+	// SkipToken in the head commit message of a push or pull request synchronization skips it, defaults to
+	// orchestrator.DefaultSkipToken
+	SkipToken string
+	// CommitMessage, e.g. GithubService.GetCommitMessage, gets the head commit message of synchronized pull requests to
+	// check it for SkipToken, pull request events don't include it. Synchronizations aren't skipped when it isn't set.
+	CommitMessage func(sha string) (string, error)
+	// CommandAccess restricts the users who may run commands by commenting, anyone may when it is empty
+	CommandAccess CommandAccess
+}
+
+var ErrPlanRequired = errors.New("a successful plan is required before applying")
+
+var _ orchestrator.EventConverter = EventConverter{}
+
+// ConvertToJobs converts pull request, pull_request_target, label, review, comment, review comment, push and
+// workflow_dispatch events with the matching Convert function
+func (c EventConverter) ConvertToJobs(event interface{}, impactedProjects []configuration.Project, requestedProject *configuration.Project, workflows map[string]configuration.Workflow) ([]orchestrator.Job, bool, error) {
+	workflows, err := orchestrator.WithFallbackWorkflow(impactedProjects, workflows, c.FallbackWorkflow)
+	if err != nil {
+		return nil, false, err
+	}
+	switch event := event.(type) {
+	case github.PullRequestEvent:
+		return c.convertPullRequestEvent(&event, impactedProjects, requestedProject, workflows)
+	case *github.PullRequestEvent:
+		return c.convertPullRequestEvent(event, impactedProjects, requestedProject, workflows)
+	case github.PullRequestTargetEvent:
+		return c.convertPullRequestTargetEvent(&event, impactedProjects, requestedProject, workflows)
+	case *github.PullRequestTargetEvent:
+		return c.convertPullRequestTargetEvent(event, impactedProjects, requestedProject, workflows)
+	case github.IssueCommentEvent:
+		return c.convertIssueCommentEvent(&event, impactedProjects, requestedProject, workflows)
+	case *github.IssueCommentEvent:
+		return c.convertIssueCommentEvent(event, impactedProjects, requestedProject, workflows)
+	case github.PullRequestReviewEvent:
+		jobs, err := ConvertGithubPullRequestReviewEventToJobs(&event, impactedProjects, workflows, c.ReviewTriggers)
+		return jobs, true, err
+	case *github.PullRequestReviewEvent:
+		jobs, err := ConvertGithubPullRequestReviewEventToJobs(event, impactedProjects, workflows, c.ReviewTriggers)
+		return jobs, true, err
+	case github.PullRequestReviewCommentEvent:
+		return c.convertPullRequestReviewCommentEvent(&event, impactedProjects, workflows)
+	case *github.PullRequestReviewCommentEvent:
+		return c.convertPullRequestReviewCommentEvent(event, impactedProjects, workflows)
+	case github.PushEvent:
+		jobs, err := ConvertGithubPushEventToJobs(&event, impactedProjects, workflows, c.skipToken())
+		return jobs, true, err
+	case *github.PushEvent:
+		jobs, err := ConvertGithubPushEventToJobs(event, impactedProjects, workflows, c.skipToken())
+		return jobs, true, err
+	case github.WorkflowDispatchEvent:
+		jobs, err := ConvertGithubWorkflowDispatchEventToJobs(&event, impactedProjects, workflows, c.Environments)
+		return jobs, true, err
+	case *github.WorkflowDispatchEvent:
+		jobs, err := ConvertGithubWorkflowDispatchEventToJobs(event, impactedProjects, workflows, c.Environments)
+		return jobs, true, err
+	}
+	return nil, false, fmt.Errorf("%w: %T", orchestrator.ErrUnsupportedEvent, event)
+}
+
+func (c EventConverter) convertPullRequestEvent(event *github.PullRequestEvent, impactedProjects []configuration.Project, requestedProject *configuration.Project, workflows map[string]configuration.Workflow) ([]orchestrator.Job, bool, error) {
+	switch event.GetAction() {
+	case "labeled", "unlabeled":
+		jobs, err := ConvertGithubPullRequestLabelEventToJobs(event, impactedProjects, workflows, c.LabelTriggers)
+		return jobs, true, err
+	case "synchronize":
+		if c.CommitMessage == nil {
+			break
+		}
+		headSHA := event.GetPullRequest().GetHead().GetSHA()
+		message, err := c.CommitMessage(headSHA)
+		if err != nil {
+			return nil, false, fmt.Errorf("error getting the message of head commit %v: %w", headSHA, err)
+		}
+		if orchestrator.ShouldSkipWithToken(message, c.skipToken()) {
+			log.Printf("skipping PR #%d, its head commit message contains %v", event.GetPullRequest().GetNumber(), c.skipToken())
+			return []orchestrator.Job{}, true, nil
+		}
+	}
+	return ConvertGithubPullRequestEventToJobsWithAutoApply(event, impactedProjects, requestedProject, workflows, c.AutoApply)
+}
+
+func (c EventConverter) convertPullRequestTargetEvent(event *github.PullRequestTargetEvent, impactedProjects []configuration.Project, requestedProject *configuration.Project, workflows map[string]configuration.Workflow) ([]orchestrator.Job, bool, error) {
+	jobs, coversAllImpactedProjects, err := c.convertPullRequestEvent(pullRequestEventFromTarget(event), impactedProjects, requestedProject, workflows)
+	if err != nil {
+		return nil, false, err
+	}
+	return restrictPullRequestTargetJobs(event, jobs), coversAllImpactedProjects, nil
+}
+
+func (c EventConverter) convertIssueCommentEvent(event *github.IssueCommentEvent, impactedProjects []configuration.Project, requestedProject *configuration.Project, workflows map[string]configuration.Workflow) ([]orchestrator.Job, bool, error) {
+	jobs, coversAllImpactedProjects, err := ConvertGithubIssueCommentEventToJobsWithCommands(event, impactedProjects, requestedProject, workflows, c.commands())
+	if err != nil {
+		return jobs, coversAllImpactedProjects, err
+	}
+	if len(jobs) > 0 {
+		if err := c.CommandAccess.Check(event.GetSender().GetLogin()); err != nil {
+			return nil, false, err
+		}
+	}
+	if c.HasSuccessfulPlan == nil {
+		return jobs, coversAllImpactedProjects, nil
+	}
+	for _, job := range jobs {
+		if !containsCommand(job.Commands, "digger apply") {
+			continue
+		}
+		planned, err := c.HasSuccessfulPlan(event.GetIssue().GetNumber(), job.ProjectName)
+		if err != nil {
+			return nil, false, fmt.Errorf("error checking the plan of project %v: %w", job.ProjectName, err)
+		}
+		if !planned {
+			return nil, false, fmt.Errorf("%w: project %v has no successful plan for the latest commit", ErrPlanRequired, job.ProjectName)
+		}
+	}
+	return jobs, coversAllImpactedProjects, nil
+}
+
+func (c EventConverter) convertPullRequestReviewCommentEvent(event *github.PullRequestReviewCommentEvent, impactedProjects []configuration.Project, workflows map[string]configuration.Workflow) ([]orchestrator.Job, bool, error) {
+	jobs, err := ConvertGithubPullRequestReviewCommentEventToJobs(event, impactedProjects, workflows)
+	if err != nil {
+		return jobs, true, err
+	}
+	if len(jobs) > 0 {
+		if err := c.CommandAccess.Check(event.GetSender().GetLogin()); err != nil {
+			return nil, false, err
+		}
+	}
+	return jobs, true, nil
+}
+
+func (c EventConverter) skipToken() string {
+	if c.SkipToken == "" {
+		return orchestrator.DefaultSkipToken
+	}
+	return c.SkipToken
+}
+
+func (c EventConverter) commands() orchestrator.CommandRegistry {
+	if c.Commands == nil {
+		return orchestrator.DefaultCommandRegistry()
+	}
+	return c.Commands
+}
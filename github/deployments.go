@@ -0,0 +1,75 @@
+package github
+
+import (
+	"fmt"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// DeploymentStateWaiting is reported by GitHub while a deployment awaits approval from the environment's required
+// reviewers, it can be read with GetDeploymentState but not set
+const DeploymentStateWaiting = "waiting"
+
+// deploymentStates are the states a deployment status can be created with
+var deploymentStates = map[string]bool{
+	"error":       true,
+	"failure":     true,
+	"inactive":    true,
+	"in_progress": true,
+	"queued":      true,
+	"pending":     true,
+	"success":     true,
+}
+
+// CreateDeployment creates a deployment of ref to environment and returns its ID. Required status checks aren't
+// enforced and the default branch isn't merged into ref, digger already ran its own checks.
+func (svc *GithubService) CreateDeployment(ref string, environment string) (int64, error) {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	autoMerge := false
+	requiredContexts := []string{}
+	deployment, _, err := svc.Client.Repositories.CreateDeployment(ctx, svc.Owner, svc.RepoName, &github.DeploymentRequest{
+		Ref:              &ref,
+		Environment:      &environment,
+		AutoMerge:        &autoMerge,
+		RequiredContexts: &requiredContexts,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error creating deployment for ref %v in environment %v: %w", ref, environment, checkPermissions(err))
+	}
+	return deployment.GetID(), nil
+}
+
+// UpdateDeploymentStatus sets the state of a deployment, e.g. "in_progress" then "success" or "failure". logURL links
+// the status to the job output and is optional.
+func (svc *GithubService) UpdateDeploymentStatus(deploymentID int64, state string, logURL string) error {
+	if !deploymentStates[state] {
+		return fmt.Errorf("unsupported deployment state: %v", state)
+	}
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	request := &github.DeploymentStatusRequest{State: &state}
+	if logURL != "" {
+		request.LogURL = &logURL
+	}
+	_, _, err := svc.Client.Repositories.CreateDeploymentStatus(ctx, svc.Owner, svc.RepoName, deploymentID, request)
+	if err != nil {
+		return fmt.Errorf("error updating deployment %v status: %w", deploymentID, checkPermissions(err))
+	}
+	return nil
+}
+
+// GetDeploymentState returns the latest state of the deployment, "pending" if it has no status yet. A state of
+// DeploymentStateWaiting means the environment's required reviewers haven't approved the deployment yet.
+func (svc *GithubService) GetDeploymentState(deploymentID int64) (string, error) {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	statuses, _, err := svc.Client.Repositories.ListDeploymentStatuses(ctx, svc.Owner, svc.RepoName, deploymentID, &github.ListOptions{PerPage: 1})
+	if err != nil {
+		return "", fmt.Errorf("error listing deployment %v statuses: %w", deploymentID, checkPermissions(err))
+	}
+	if len(statuses) == 0 {
+		return "pending", nil
+	}
+	return statuses[0].GetState(), nil
+}
@@ -0,0 +1,64 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestUpdateDeploymentStatus(t *testing.T) {
+	svc, mux := setupTestService(t)
+	var states []string
+	mux.HandleFunc("/repos/diggerhq/demo/deployments/7/statuses", func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&request)
+		states = append(states, request["state"].(string))
+		fmt.Fprint(w, `{"id": 1}`)
+	})
+
+	assert.NoError(t, svc.UpdateDeploymentStatus(7, "in_progress", ""))
+	assert.Error(t, svc.UpdateDeploymentStatus(7, DeploymentStateWaiting, ""))
+	assert.Error(t, svc.UpdateDeploymentStatus(7, "done", ""))
+	assert.Equal(t, []string{"in_progress"}, states)
+}
+
+func TestGetDeploymentState(t *testing.T) {
+	svc, mux := setupTestService(t)
+	mux.HandleFunc("/repos/diggerhq/demo/deployments/7/statuses", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id": 2, "state": "waiting"}, {"id": 1, "state": "queued"}]`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/deployments/8/statuses", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	})
+
+	state, err := svc.GetDeploymentState(7)
+	assert.NoError(t, err)
+	assert.Equal(t, DeploymentStateWaiting, state)
+
+	state, err = svc.GetDeploymentState(8)
+	assert.NoError(t, err)
+	assert.Equal(t, "pending", state)
+}
+
+func TestDeploymentsReportMissingPermission(t *testing.T) {
+	svc, mux := setupTestService(t)
+	forbidden := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message": "Resource not accessible by integration"}`)
+	}
+	mux.HandleFunc("/repos/diggerhq/demo/deployments", forbidden)
+	mux.HandleFunc("/repos/diggerhq/demo/deployments/7/statuses", forbidden)
+
+	_, err := svc.CreateDeployment("main", "production")
+	assert.ErrorIs(t, err, ErrInsufficientPermissions)
+	assert.ErrorContains(t, err, "deployments:write")
+
+	err = svc.UpdateDeploymentStatus(7, "in_progress", "")
+	assert.ErrorIs(t, err, ErrInsufficientPermissions)
+
+	_, err = svc.GetDeploymentState(7)
+	assert.ErrorIs(t, err, ErrInsufficientPermissions)
+	assert.ErrorContains(t, err, "deployments:read")
+}
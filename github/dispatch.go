@@ -0,0 +1,84 @@
+package github
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	configuration "github.com/diggerhq/lib-digger-config"
+	orchestrator "github.com/diggerhq/lib-orchestrator"
+	"github.com/google/go-github/v55/github"
+)
+
+var ErrUnknownEnvironment = errors.New("unknown environment")
+
+// Environment is what an "environment" input of workflow_dispatch runs selects for the jobs
+type Environment struct {
+	// Workspace replaces the workspace of the projects when set
+	Workspace string
+	// VarFile is passed to terraform with -var-file when set, relative to the project directory
+	VarFile string
+}
+
+// ConvertGithubWorkflowDispatchEventToJobs converts a manual workflow_dispatch run to a job per impacted project
+// running the "command" input, "digger plan" or "digger apply" and "digger plan" by default. The "environment" input,
+// when given, must be one of environments and sets the workspace and var file of the jobs.
+func ConvertGithubWorkflowDispatchEventToJobs(payload *github.WorkflowDispatchEvent, impactedProjects []configuration.Project, workflows map[string]configuration.Workflow, environments map[string]Environment) ([]orchestrator.Job, error) {
+	inputs := make(map[string]interface{})
+	if len(payload.Inputs) > 0 {
+		if err := json.Unmarshal(payload.Inputs, &inputs); err != nil {
+			return nil, fmt.Errorf("invalid workflow_dispatch inputs: %v", err)
+		}
+	}
+	input := func(name string) string {
+		if value, ok := inputs[name]; ok && value != nil {
+			return strings.TrimSpace(fmt.Sprint(value))
+		}
+		return ""
+	}
+
+	command := strings.ToLower(input("command"))
+	switch command {
+	case "":
+		command = "digger plan"
+	case "digger plan", "digger apply":
+	default:
+		return nil, fmt.Errorf("unsupported command %q in workflow_dispatch inputs, expected \"digger plan\" or \"digger apply\"", command)
+	}
+
+	var environment *Environment
+	if name := input("environment"); name != "" {
+		env, ok := environments[name]
+		if !ok {
+			allowed := make([]string, 0, len(environments))
+			for allowedName := range environments {
+				allowed = append(allowed, allowedName)
+			}
+			sort.Strings(allowed)
+			return nil, fmt.Errorf("%w %v, expected one of: %v", ErrUnknownEnvironment, name, strings.Join(allowed, ", "))
+		}
+		environment = &env
+	}
+
+	jobs, err := buildPullRequestJobs(impactedProjects, workflows, pullRequestJobContext{
+		eventName:   "workflow_dispatch",
+		namespace:   payload.GetRepo().GetFullName(),
+		requestedBy: payload.GetSender().GetLogin(),
+	}, func(workflow configuration.Workflow) []string {
+		return []string{command}
+	})
+	if err != nil || environment == nil {
+		return jobs, err
+	}
+	for i := range jobs {
+		if environment.Workspace != "" {
+			jobs[i].ProjectWorkspace = environment.Workspace
+		}
+		if environment.VarFile != "" {
+			jobs[i].CommandArgs = append(jobs[i].CommandArgs, "-var-file="+environment.VarFile)
+		}
+	}
+	return jobs, nil
+}
@@ -0,0 +1,83 @@
+package github
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+var ErrInsufficientPermissions = errors.New("insufficient permissions")
+
+// permissionsByEndpoint maps path segments of API endpoints to the fine-grained token permission they need, the
+// first match wins
+var permissionsByEndpoint = []struct {
+	pathSegment string
+	permission  string
+}{
+	{"actions", "actions"},
+	{"deployments", "deployments"},
+	{"statuses", "statuses"},
+	{"status", "statuses"},
+	{"check-runs", "checks"},
+	{"merge", "contents"},
+	{"update-branch", "contents"},
+	{"pulls", "pull_requests"},
+	{"issues", "issues"},
+	{"teams", "members"},
+}
+
+// endpointSegments returns the segments of an API path that identify the endpoint, i.e. without the API prefix and
+// without the owner, repository or organisation names which could look like endpoints themselves
+func endpointSegments(apiPath string) []string {
+	segments := strings.Split(strings.Trim(apiPath, "/"), "/")
+	for i, segment := range segments {
+		if segment == "repos" && len(segments) > i+3 {
+			return segments[i+3:]
+		}
+		if segment == "orgs" && len(segments) > i+2 {
+			return segments[i+2:]
+		}
+	}
+	return segments
+}
+
+// requiredPermission guesses the permission a request lacked from its path, e.g. "issues:write" to comment
+func requiredPermission(req *http.Request) string {
+	access := "write"
+	if req.Method == http.MethodGet {
+		access = "read"
+	}
+	segments := endpointSegments(req.URL.Path)
+	for _, endpoint := range permissionsByEndpoint {
+		for _, segment := range segments {
+			if segment == endpoint.pathSegment {
+				return endpoint.permission + ":" + access
+			}
+		}
+	}
+	return ""
+}
+
+// checkPermissions wraps 403 Forbidden errors in ErrInsufficientPermissions naming the likely missing permission,
+// other errors, including those already wrapped, are returned unchanged. Rate limit errors are also 403 but have
+// their own error types in go-github.
+func checkPermissions(err error) error {
+	if errors.Is(err, ErrInsufficientPermissions) {
+		return err
+	}
+	var errorResponse *github.ErrorResponse
+	if !errors.As(err, &errorResponse) || errorResponse.Response == nil || errorResponse.Response.StatusCode != http.StatusForbidden {
+		return err
+	}
+	permission := ""
+	if errorResponse.Response.Request != nil {
+		permission = requiredPermission(errorResponse.Response.Request)
+	}
+	if permission == "" {
+		return fmt.Errorf("%w: %v", ErrInsufficientPermissions, errorResponse.Message)
+	}
+	return fmt.Errorf("%w, the token likely lacks the %v permission: %v", ErrInsufficientPermissions, permission, errorResponse.Message)
+}
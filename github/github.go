@@ -2,126 +2,895 @@ package github
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/dominikbraun/graph"
 	"log"
+	"net/http"
+	"path"
+	"sort"
 	"strings"
+	"time"
 
 	configuration "github.com/diggerhq/lib-digger-config"
 	orchestrator "github.com/diggerhq/lib-orchestrator"
+	"github.com/diggerhq/lib-orchestrator/github/models"
 	"github.com/google/go-github/v55/github"
 )
 
-func NewGitHubService(ghToken string, repoName string, owner string) GithubService {
+// NewGitHubService creates a service authenticated with ghToken. Requests go through http.DefaultTransport, which
+// honors the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables.
+func NewGitHubService(ghToken string, repoName string, owner string) (GithubService, error) {
+	if err := validateServiceParams(ghToken, repoName, owner); err != nil {
+		return GithubService{}, err
+	}
 	client := github.NewTokenClient(context.Background(), ghToken)
 	return GithubService{
 		Client:   client,
 		RepoName: repoName,
 		Owner:    owner,
+	}, nil
+}
+
+// MustNewGitHubService is like NewGitHubService but panics on invalid parameters
+func MustNewGitHubService(ghToken string, repoName string, owner string) GithubService {
+	svc, err := NewGitHubService(ghToken, repoName, owner)
+	if err != nil {
+		panic(err)
+	}
+	return svc
+}
+
+// NewGitHubServiceWithCache creates a service whose GET requests are conditional on the ETag stored in cache,
+// unchanged resources are then served from the cache without using the API rate limit
+func NewGitHubServiceWithCache(ghToken string, repoName string, owner string, cache ResponseCache) (GithubService, error) {
+	return NewGitHubServiceWithOptions(ghToken, repoName, owner, ServiceOptions{Cache: cache})
+}
+
+// NewGitHubServiceWithTokenSource creates a service authenticated with ghToken that mints a new token from
+// tokenSource and retries once whenever a request is rejected as unauthorized, so that long-running processes
+// survive the expiry of installation tokens
+func NewGitHubServiceWithTokenSource(ghToken string, tokenSource TokenSource, repoName string, owner string) (GithubService, error) {
+	if tokenSource == nil {
+		return GithubService{}, fmt.Errorf("token source is nil")
+	}
+	return NewGitHubServiceWithOptions(ghToken, repoName, owner, ServiceOptions{TokenSource: tokenSource})
+}
+
+// ServiceOptions configures the HTTP transport of NewGitHubServiceWithOptions, the zero value gives the same service
+// as NewGitHubService
+type ServiceOptions struct {
+	// Cache makes GET requests conditional on the ETag of the cached response, see NewGitHubServiceWithCache
+	Cache ResponseCache
+	// TokenSource refreshes the token on unauthorized responses, see NewGitHubServiceWithTokenSource
+	TokenSource TokenSource
+	// BaseTransport sends the requests, defaults to http.DefaultTransport which honors the HTTPS_PROXY, HTTP_PROXY and
+	// NO_PROXY environment variables. A custom *http.Transport must set Proxy, e.g. to http.ProxyFromEnvironment, to
+	// go through a proxy.
+	BaseTransport http.RoundTripper
+}
+
+// NewGitHubServiceWithOptions creates a service combining response caching, token refreshing and a custom transport
+func NewGitHubServiceWithOptions(ghToken string, repoName string, owner string, opts ServiceOptions) (GithubService, error) {
+	if err := validateServiceParams(ghToken, repoName, owner); err != nil {
+		return GithubService{}, err
+	}
+	transport := opts.BaseTransport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if opts.TokenSource != nil {
+		transport = &refreshingTokenTransport{base: transport, tokenSource: opts.TokenSource, token: ghToken}
+	}
+	if opts.Cache != nil {
+		transport = &etagTransport{base: transport, cache: opts.Cache}
+	}
+
+	client := github.NewClient(&http.Client{Transport: transport})
+	if opts.TokenSource == nil {
+		client = client.WithAuthToken(ghToken)
+	}
+	return GithubService{
+		Client:   client,
+		RepoName: repoName,
+		Owner:    owner,
+	}, nil
+}
+
+func validateServiceParams(ghToken string, repoName string, owner string) error {
+	if ghToken == "" {
+		return fmt.Errorf("github token is empty")
+	}
+	if owner == "" {
+		return fmt.Errorf("repository owner is empty")
+	}
+	if repoName == "" {
+		return fmt.Errorf("repository name is empty")
 	}
+	return nil
 }
 
 type GithubService struct {
 	Client   *github.Client
 	RepoName string
 	Owner    string
+	// IgnoredStatusContexts are excluded when waiting for the combined status, e.g. digger's own status context
+	IgnoredStatusContexts []string
+	// StatusReporter publishes statuses set by SetStatus, commit statuses are used when nil
+	StatusReporter StatusReporter
+	// StatusConcurrency is the number of statuses SetStatuses sets at a time, defaults to 4
+	StatusConcurrency int
+	// Login is the login the client authenticates as, e.g. "github-actions[bot]", looked up with the users API when
+	// empty. Installation tokens can't look themselves up so it must be set when using them.
+	Login string
+	// ReplanConcurrency is the number of pull requests ReplanAllOpenPRs looks up at a time, defaults to 4
+	ReplanConcurrency int
+	// TeamCache keeps the results of GetUserTeams for a short time when set, see NewTeamCache
+	TeamCache *TeamCache
+	// PerPage is the page size of list operations, defaults to 100 which is the maximum allowed by GitHub
+	PerPage int
+	// SquashCoAuthors appends a Co-authored-by trailer per commit author other than the pull request author to the
+	// message of squash merges, see MergePullRequest
+	SquashCoAuthors bool
+	// UseGraphQLForChangedFiles lists pull request files through the GraphQL API, which is faster and isn't capped
+	// at 3000 files like the REST API
+	UseGraphQLForChangedFiles bool
+	// OperationTimeout bounds each API operation, including all pages of list operations, so that a stuck request
+	// can't block a whole run. Defaults to 30 seconds.
+	OperationTimeout time.Duration
 }
 
+const defaultOperationTimeout = 30 * time.Second
+
+// ForRepository returns a copy of the service operating on another repository with the same client and settings, so
+// that org-wide runners can serve every repository from a single authenticated client
+func (svc *GithubService) ForRepository(owner string, repoName string) GithubService {
+	repoSvc := *svc
+	repoSvc.Owner = owner
+	repoSvc.RepoName = repoName
+	return repoSvc
+}
+
+func (svc *GithubService) perPage() int {
+	if svc.PerPage > 0 {
+		return svc.PerPage
+	}
+	return 100
+}
+
+// operationContext returns the context of an API operation, service methods don't take a context from the caller
+// so the operation timeout is always applied
+func (svc *GithubService) operationContext() (context.Context, context.CancelFunc) {
+	timeout := svc.OperationTimeout
+	if timeout <= 0 {
+		timeout = defaultOperationTimeout
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// GetUserTeams returns the names of the teams of organisation that user is an active member of
 func (svc *GithubService) GetUserTeams(organisation string, user string) ([]string, error) {
-	teamsResponse, _, err := svc.Client.Teams.ListTeams(context.Background(), organisation, nil)
-	if err != nil {
-		log.Fatalf("Failed to list github teams: %v", err)
+	if svc.TeamCache != nil {
+		if teams, ok := svc.TeamCache.get(organisation, user); ok {
+			return teams, nil
+		}
 	}
+
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	var teamsResponse []*github.Team
+	opts := &github.ListOptions{PerPage: svc.perPage()}
+	for {
+		page, resp, err := svc.Client.Teams.ListTeams(ctx, organisation, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list github teams: %w", checkPermissions(err))
+		}
+		teamsResponse = append(teamsResponse, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
 	var teams []string
 	for _, team := range teamsResponse {
-		teamMembers, _, _ := svc.Client.Teams.ListTeamMembersBySlug(context.Background(), organisation, *team.Slug, nil)
-		for _, member := range teamMembers {
-			if *member.Login == user {
-				teams = append(teams, *team.Name)
-				break
-			}
+		member, err := svc.IsUserInTeam(organisation, team.GetSlug(), user)
+		if err != nil {
+			return nil, err
+		}
+		if member {
+			teams = append(teams, team.GetName())
 		}
 	}
 
+	if svc.TeamCache != nil {
+		svc.TeamCache.set(organisation, user, teams)
+	}
 	return teams, nil
 }
 
+// GetUserTeamsIn returns the slugs of the candidate teams that user is an active member of, with a single API call
+// per candidate, e.g. for the teams allowed to apply. It is much faster than GetUserTeams in large organisations.
+func (svc *GithubService) GetUserTeamsIn(organisation string, user string, candidateTeamSlugs []string) ([]string, error) {
+	var teams []string
+	for _, teamSlug := range candidateTeamSlugs {
+		member, err := svc.IsUserInTeam(organisation, teamSlug, user)
+		if err != nil {
+			return nil, err
+		}
+		if member {
+			teams = append(teams, teamSlug)
+		}
+	}
+	return teams, nil
+}
+
+// IsUserInTeam tells whether user is an active member of the team, pending invitations don't count
+func (svc *GithubService) IsUserInTeam(organisation string, teamSlug string, user string) (bool, error) {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	membership, resp, err := svc.Client.Teams.GetTeamMembershipBySlug(ctx, organisation, teamSlug, user)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error getting membership of %v in team %v: %w", user, teamSlug, checkPermissions(err))
+	}
+	return membership.GetState() == "active", nil
+}
+
 func (svc *GithubService) GetChangedFiles(prNumber int) ([]string, error) {
-	files, _, err := svc.Client.PullRequests.ListFiles(context.Background(), svc.Owner, svc.RepoName, prNumber, nil)
+	fileNames, err := svc.listChangedFiles(prNumber)
 	if err != nil {
-		log.Fatalf("error getting pull request files: %v", err)
+		return nil, fmt.Errorf("error getting pull request files: %w", checkPermissions(err))
 	}
+	return fileNames, nil
+}
 
-	fileNames := make([]string, len(files))
+// GetChangedFilesSince returns the files changed by the commits pushed to a pull request after sinceSHA, e.g. the last
+// planned commit, for incremental plans. All the files of the pull request are returned when sinceSHA is empty.
+func (svc *GithubService) GetChangedFilesSince(prNumber int, sinceSHA string) ([]string, error) {
+	if sinceSHA == "" {
+		return svc.GetChangedFiles(prNumber)
+	}
+	_, headSHA, err := svc.GetBaseAndHeadSHA(prNumber)
+	if err != nil {
+		return nil, err
+	}
 
-	for i, file := range files {
-		fileNames[i] = *file.Filename
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	var fileNames []string
+	opts := &github.ListOptions{PerPage: svc.perPage()}
+	for {
+		comparison, resp, err := svc.Client.Repositories.CompareCommits(ctx, svc.Owner, svc.RepoName, sinceSHA, headSHA, opts)
+		if err != nil {
+			return nil, fmt.Errorf("error comparing %v with %v: %w", sinceSHA, headSHA, checkPermissions(err))
+		}
+		for _, file := range comparison.Files {
+			fileNames = append(fileNames, orchestrator.NormalizePath(file.GetFilename()))
+		}
+		if resp.NextPage == 0 {
+			return fileNames, nil
+		}
+		opts.Page = resp.NextPage
 	}
-	return fileNames, nil
+}
+
+// GetChangedFilesWithPatch pages through all pull request files with their diff, e.g. for policies checking the
+// content of changes without a checkout
+func (svc *GithubService) GetChangedFilesWithPatch(prNumber int) ([]orchestrator.FilePatch, error) {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	var patches []orchestrator.FilePatch
+	opts := &github.ListOptions{PerPage: svc.perPage()}
+	for {
+		files, resp, err := svc.Client.PullRequests.ListFiles(ctx, svc.Owner, svc.RepoName, prNumber, opts)
+		if err != nil {
+			return nil, fmt.Errorf("error getting pull request files: %w", checkPermissions(err))
+		}
+		for _, file := range files {
+			patches = append(patches, orchestrator.FilePatch{
+				Filename: orchestrator.NormalizePath(file.GetFilename()),
+				Status:   file.GetStatus(),
+				// binary files have no patch
+				Patch: file.GetPatch(),
+			})
+		}
+		if resp.NextPage == 0 {
+			return patches, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// GetChangedDirectories returns the sorted unique directories of the files changed by a pull request, files at the
+// root of the repository are in "."
+func (svc *GithubService) GetChangedDirectories(prNumber int) ([]string, error) {
+	fileNames, err := svc.GetChangedFiles(prNumber)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	dirs := make([]string, 0)
+	for _, fileName := range fileNames {
+		dir := path.Dir(fileName)
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+// listChangedFiles uses the GraphQL API when enabled, falling back to REST if the GraphQL query fails
+func (svc *GithubService) listChangedFiles(prNumber int) ([]string, error) {
+	if svc.UseGraphQLForChangedFiles {
+		fileNames, err := svc.getChangedFilesGraphQL(prNumber)
+		if err == nil {
+			return fileNames, nil
+		}
+		log.Printf("failed to get pull request files through graphql, falling back to rest api: %v", err)
+	}
+	fileNames, _, err := svc.GetChangedFilesWithResponse(prNumber)
+	return fileNames, err
+}
+
+// GetChangedFilesWithResponse pages through all pull request files and returns the go-github response of the last page
+// for callers interested in rate limit or ETag headers. File paths always use forward slashes.
+func (svc *GithubService) GetChangedFilesWithResponse(prNumber int) ([]string, *github.Response, error) {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	var fileNames []string
+	opts := &github.ListOptions{PerPage: svc.perPage()}
+	for {
+		files, resp, err := svc.Client.PullRequests.ListFiles(ctx, svc.Owner, svc.RepoName, prNumber, opts)
+		if err != nil {
+			return nil, resp, err
+		}
+		for _, file := range files {
+			fileNames = append(fileNames, orchestrator.NormalizePath(*file.Filename))
+		}
+		if resp.NextPage == 0 {
+			return fileNames, resp, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// GetMergedPullRequestChangedFiles returns the files changed by the commit the pull request was merged with
+func (svc *GithubService) GetMergedPullRequestChangedFiles(prNumber int) ([]string, error) {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	pr, _, err := svc.Client.PullRequests.Get(ctx, svc.Owner, svc.RepoName, prNumber)
+	if err != nil {
+		return nil, fmt.Errorf("error getting pull request: %w", checkPermissions(err))
+	}
+	if !pr.GetMerged() {
+		return nil, fmt.Errorf("pull request %d is not merged", prNumber)
+	}
+
+	var fileNames []string
+	opts := &github.ListOptions{PerPage: svc.perPage()}
+	for {
+		commit, resp, err := svc.Client.Repositories.GetCommit(ctx, svc.Owner, svc.RepoName, pr.GetMergeCommitSHA(), opts)
+		if err != nil {
+			return nil, fmt.Errorf("error getting merge commit %v: %w", pr.GetMergeCommitSHA(), checkPermissions(err))
+		}
+		for _, file := range commit.Files {
+			fileNames = append(fileNames, orchestrator.NormalizePath(file.GetFilename()))
+		}
+		if resp.NextPage == 0 {
+			return fileNames, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// GetImpactedProjects returns the projects of cfg modified by the pull request, and whether that list is empty so
+// the caller can report that there are no terraform changes
+func (svc *GithubService) GetImpactedProjects(prNumber int, cfg *configuration.DiggerConfig) ([]configuration.Project, bool, error) {
+	changedFiles, err := svc.listChangedFiles(prNumber)
+	if err != nil {
+		return nil, false, fmt.Errorf("error getting pull request files: %w", checkPermissions(err))
+	}
+	impactedProjects := cfg.GetModifiedProjects(changedFiles)
+	return impactedProjects, len(impactedProjects) == 0, nil
 }
 
 func (svc *GithubService) PublishComment(prNumber int, comment string) error {
-	_, _, err := svc.Client.Issues.CreateComment(context.Background(), svc.Owner, svc.RepoName, prNumber, &github.IssueComment{Body: &comment})
-	return err
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	_, _, err := svc.Client.Issues.CreateComment(ctx, svc.Owner, svc.RepoName, prNumber, &github.IssueComment{Body: &comment})
+	return checkPermissions(err)
+}
+
+// AcknowledgeCommand immediately comments that a command was received, e.g. "⏳ Running digger plan…", so that users
+// don't wait in silence until the jobs start. The returned comment ID can be passed to EditComment to report results.
+func (svc *GithubService) AcknowledgeCommand(prNumber int, command string) (int64, error) {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	body := fmt.Sprintf("⏳ Running %v…", strings.TrimSpace(command))
+	comment, _, err := svc.Client.Issues.CreateComment(ctx, svc.Owner, svc.RepoName, prNumber, &github.IssueComment{Body: &body})
+	if err != nil {
+		return 0, fmt.Errorf("error acknowledging command on PR #%d: %w", prNumber, checkPermissions(err))
+	}
+	return comment.GetID(), nil
 }
 
 func (svc *GithubService) GetComments(prNumber int) ([]orchestrator.Comment, error) {
-	comments, _, err := svc.Client.Issues.ListComments(context.Background(), svc.Owner, svc.RepoName, prNumber, &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}})
-	commentBodies := make([]orchestrator.Comment, len(comments))
-	for i, comment := range comments {
-		commentBodies[i] = orchestrator.Comment{
-			Id:   *comment.ID,
-			Body: comment.Body,
+	commentBodies, _, err := svc.GetCommentsWithResponse(prNumber)
+	return commentBodies, err
+}
+
+// GetCommentsWithResponse pages through all pull request comments and returns the go-github response of the last page
+func (svc *GithubService) GetCommentsWithResponse(prNumber int) ([]orchestrator.Comment, *github.Response, error) {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	var commentBodies []orchestrator.Comment
+	opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: svc.perPage()}}
+	for {
+		comments, resp, err := svc.Client.Issues.ListComments(ctx, svc.Owner, svc.RepoName, prNumber, opts)
+		if err != nil {
+			return commentBodies, resp, checkPermissions(err)
+		}
+		for _, comment := range comments {
+			commentBodies = append(commentBodies, orchestrator.Comment{
+				Id:   *comment.ID,
+				Body: comment.Body,
+			})
+		}
+		if resp.NextPage == 0 {
+			return commentBodies, resp, nil
 		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// GetCommentsSince pages through the pull request comments created or edited at or after since, so that polling for
+// commands doesn't fetch the whole conversation again. GitHub filters on the time comments were last updated, with a
+// precision of one second: edited comments are returned again and callers should keep the IDs they already handled.
+func (svc *GithubService) GetCommentsSince(prNumber int, since time.Time) ([]orchestrator.Comment, error) {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	var comments []orchestrator.Comment
+	opts := &github.IssueListCommentsOptions{Since: &since, ListOptions: github.ListOptions{PerPage: svc.perPage()}}
+	for {
+		page, resp, err := svc.Client.Issues.ListComments(ctx, svc.Owner, svc.RepoName, prNumber, opts)
+		if err != nil {
+			return nil, fmt.Errorf("error getting comments since %v: %w", since.Format(time.RFC3339), checkPermissions(err))
+		}
+		for _, comment := range page {
+			comments = append(comments, orchestrator.Comment{
+				Id:   comment.GetID(),
+				Body: comment.Body,
+			})
+		}
+		if resp.NextPage == 0 {
+			return comments, nil
+		}
+		opts.Page = resp.NextPage
 	}
-	return commentBodies, err
+}
+
+// FindCommentByMarker returns the first comment whose body contains marker (typically an HTML comment such as
+// "<!-- digger-plan:project -->"), or nil if there is none
+func (svc *GithubService) FindCommentByMarker(prNumber int, marker string) (*orchestrator.Comment, error) {
+	comments, err := svc.GetComments(prNumber)
+	if err != nil {
+		return nil, fmt.Errorf("error getting comments: %w", err)
+	}
+	for _, comment := range comments {
+		if comment.Body != nil && strings.Contains(*comment.Body, marker) {
+			return &comment, nil
+		}
+	}
+	return nil, nil
+}
+
+// UpsertSummaryComment posts the summary of all projects of a pull request, or edits the summary comment posted
+// before so that it stays a single comment updated in place. It returns the ID of the comment.
+func (svc *GithubService) UpsertSummaryComment(prNumber int, summary orchestrator.SummaryData) (int64, error) {
+	body := orchestrator.FormatSummary(summary)
+	existing, err := svc.FindCommentByMarker(prNumber, orchestrator.SummaryCommentMarker)
+	if err != nil {
+		return 0, err
+	}
+	if existing != nil {
+		if err := svc.EditComment(prNumber, existing.Id, body); err != nil {
+			return 0, fmt.Errorf("error editing summary comment on PR #%d: %w", prNumber, err)
+		}
+		return existing.Id.(int64), nil
+	}
+
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	comment, _, err := svc.Client.Issues.CreateComment(ctx, svc.Owner, svc.RepoName, prNumber, &github.IssueComment{Body: &body})
+	if err != nil {
+		return 0, fmt.Errorf("error posting summary comment on PR #%d: %w", prNumber, checkPermissions(err))
+	}
+	return comment.GetID(), nil
+}
+
+// DeleteCommentsByMarker deletes every comment whose body contains marker and returns how many were deleted, a
+// failed deletion doesn't stop the others and all failures are returned together
+func (svc *GithubService) DeleteCommentsByMarker(prNumber int, marker string) (int, error) {
+	comments, err := svc.GetComments(prNumber)
+	if err != nil {
+		return 0, fmt.Errorf("error getting comments: %w", err)
+	}
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	deleted := 0
+	var errs []error
+	for _, comment := range comments {
+		if comment.Body == nil || !strings.Contains(*comment.Body, marker) {
+			continue
+		}
+		_, err := svc.Client.Issues.DeleteComment(ctx, svc.Owner, svc.RepoName, comment.Id.(int64))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error deleting comment %v: %w", comment.Id, checkPermissions(err)))
+			continue
+		}
+		deleted++
+	}
+	return deleted, errors.Join(errs...)
 }
 
 func (svc *GithubService) EditComment(prNumber int, id interface{}, comment string) error {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
 	commentId := id.(int64)
-	_, _, err := svc.Client.Issues.EditComment(context.Background(), svc.Owner, svc.RepoName, commentId, &github.IssueComment{Body: &comment})
-	return err
+	_, _, err := svc.Client.Issues.EditComment(ctx, svc.Owner, svc.RepoName, commentId, &github.IssueComment{Body: &comment})
+	return checkPermissions(err)
+}
+
+var ErrCommentEditConflict = errors.New("comment was edited concurrently")
+
+// commentUpdateAttempts bounds the update-edit-verify cycles of UpdateComment
+const commentUpdateAttempts = 3
+
+// UpdateComment edits a comment with update applied to its current body, e.g. to fill in the section of one project
+// in a comment shared by concurrent runs. GitHub ignores If-Match on comment edits, so the comment is read back after
+// the edit: when another run overwrote it in the meantime, update is applied again to the body found, up to
+// commentUpdateAttempts times before ErrCommentEditConflict is returned. update must therefore be idempotent.
+func (svc *GithubService) UpdateComment(id int64, update func(body string) string) error {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	comment, _, err := svc.Client.Issues.GetComment(ctx, svc.Owner, svc.RepoName, id)
+	if err != nil {
+		return fmt.Errorf("error getting comment %d: %w", id, checkPermissions(err))
+	}
+	current := comment.GetBody()
+	for attempt := 1; attempt <= commentUpdateAttempts; attempt++ {
+		body := update(current)
+		if _, _, err := svc.Client.Issues.EditComment(ctx, svc.Owner, svc.RepoName, id, &github.IssueComment{Body: &body}); err != nil {
+			return fmt.Errorf("error editing comment %d: %w", id, checkPermissions(err))
+		}
+
+		comment, _, err := svc.Client.Issues.GetComment(ctx, svc.Owner, svc.RepoName, id)
+		if err != nil {
+			return fmt.Errorf("error getting comment %d: %w", id, checkPermissions(err))
+		}
+		current = comment.GetBody()
+		// a later edit may have kept our change, e.g. a run that read the comment after our edit
+		if current == body || update(current) == current {
+			return nil
+		}
+		log.Printf("comment %d was overwritten concurrently, retrying the update (attempt %d)", id, attempt)
+	}
+	return fmt.Errorf("%w: gave up updating comment %d after %d attempts", ErrCommentEditConflict, id, commentUpdateAttempts)
 }
 
 func (svc *GithubService) SetStatus(prNumber int, status string, statusContext string) error {
-	pr, _, err := svc.Client.PullRequests.Get(context.Background(), svc.Owner, svc.RepoName, prNumber)
+	return svc.setStatus(prNumber, status, statusContext, statusContext)
+}
+
+func (svc *GithubService) SetJobStatus(prNumber int, status orchestrator.JobStatus, statusContext string) error {
+	return svc.setStatus(prNumber, status.CommitState(), statusContext, status.Description())
+}
+
+func (svc *GithubService) setStatus(prNumber int, status string, statusContext string, description string) error {
+	_, headSHA, err := svc.GetBaseAndHeadSHA(prNumber)
 	if err != nil {
-		log.Fatalf("error getting pull request: %v", err)
+		return checkPermissions(err)
 	}
 
-	_, _, err = svc.Client.Repositories.CreateStatus(context.Background(), svc.Owner, svc.RepoName, *pr.Head.SHA, &github.RepoStatus{
-		State:       &status,
-		Context:     &statusContext,
-		Description: &statusContext,
-	})
-	return err
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	return checkPermissions(svc.statusReporter().ReportStatus(ctx, headSHA, status, statusContext, description))
 }
 
 func (svc *GithubService) GetCombinedPullRequestStatus(prNumber int) (string, error) {
-	pr, _, err := svc.Client.PullRequests.Get(context.Background(), svc.Owner, svc.RepoName, prNumber)
+	_, headSHA, err := svc.GetBaseAndHeadSHA(prNumber)
 	if err != nil {
-		log.Fatalf("error getting pull request: %v", err)
+		return "", checkPermissions(err)
 	}
 
-	statuses, _, err := svc.Client.Repositories.GetCombinedStatus(context.Background(), svc.Owner, svc.RepoName, pr.Head.GetSHA(), nil)
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	statuses, _, err := svc.Client.Repositories.GetCombinedStatus(ctx, svc.Owner, svc.RepoName, headSHA, nil)
 	if err != nil {
-		log.Fatalf("error getting combined status: %v", err)
+		return "", fmt.Errorf("error getting combined status: %w", checkPermissions(err))
 	}
 
 	return *statuses.State, nil
 }
 
-func (svc *GithubService) MergePullRequest(prNumber int) error {
-	pr, _, err := svc.Client.PullRequests.Get(context.Background(), svc.Owner, svc.RepoName, prNumber)
+var ErrStatusContextNotFound = errors.New("status context not found")
+
+// GetStatusForContext returns the state of the status context of the pull request head, e.g. of "digger/plan/dev",
+// rather than the state combined over all contexts. Check runs named statusContext are considered when there is no
+// commit status with that context, their state is mapped to "pending", "success" or "failure".
+// ErrStatusContextNotFound is returned when the context wasn't reported on the head.
+func (svc *GithubService) GetStatusForContext(prNumber int, statusContext string) (string, error) {
+	_, headSHA, err := svc.GetBaseAndHeadSHA(prNumber)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	opts := &github.ListOptions{PerPage: svc.perPage()}
+	for {
+		combined, resp, err := svc.Client.Repositories.GetCombinedStatus(ctx, svc.Owner, svc.RepoName, headSHA, opts)
+		if err != nil {
+			return "", fmt.Errorf("error getting combined status: %w", checkPermissions(err))
+		}
+		// the combined status only lists the latest status of each context
+		for _, status := range combined.Statuses {
+			if status.GetContext() == statusContext {
+				return status.GetState(), nil
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	checkRuns, err := svc.ListCheckRunsForRef(headSHA)
+	if err != nil {
+		return "", err
+	}
+	for _, checkRun := range checkRuns {
+		if checkRun.GetName() != statusContext {
+			continue
+		}
+		if checkRun.GetStatus() != "completed" {
+			return "pending", nil
+		}
+		switch checkRun.GetConclusion() {
+		case "success", "neutral", "skipped":
+			return "success", nil
+		}
+		return "failure", nil
+	}
+	return "", fmt.Errorf("%w: %v on PR #%d", ErrStatusContextNotFound, statusContext, prNumber)
+}
+
+const (
+	initialStatusPollInterval = 5 * time.Second
+	maxStatusPollInterval     = 60 * time.Second
+)
+
+// WaitForCombinedStatus polls the combined state of the commit statuses and check runs of the pull request head with
+// exponential backoff until it is terminal ("success" or "failure") or timeout elapses. Reaching a terminal state
+// that isn't one of the desired states (default "success" and "failure") is an error. Statuses and check runs whose
+// context or name is listed in IgnoredStatusContexts are not taken into account, so digger doesn't wait on itself.
+func (svc *GithubService) WaitForCombinedStatus(prNumber int, desired []string, timeout time.Duration) (string, error) {
+	if len(desired) == 0 {
+		desired = []string{"success", "failure"}
+	}
+	deadline := time.Now().Add(timeout)
+	interval := initialStatusPollInterval
+	for {
+		state, err := svc.getCombinedStatusIgnoringContexts(prNumber)
+		if err != nil {
+			return "", err
+		}
+		for _, desiredState := range desired {
+			if state == desiredState {
+				return state, nil
+			}
+		}
+		if state != "pending" {
+			return state, fmt.Errorf("combined status of pull request %d is %v", prNumber, state)
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return state, fmt.Errorf("timed out waiting for combined status of pull request %d, last state: %v", prNumber, state)
+		}
+		time.Sleep(interval)
+		interval *= 2
+		if interval > maxStatusPollInterval {
+			interval = maxStatusPollInterval
+		}
+	}
+}
+
+// getCombinedStatusIgnoringContexts combines commit statuses and check runs like GitHub does for the pull request
+// checks: any failure fails, anything unfinished or no check at all is pending
+func (svc *GithubService) getCombinedStatusIgnoringContexts(prNumber int) (string, error) {
+	_, headSHA, err := svc.GetBaseAndHeadSHA(prNumber)
 	if err != nil {
-		log.Fatalf("error getting pull request: %v", err)
+		return "", err
+	}
+
+	ignored := make(map[string]bool)
+	for _, statusContext := range svc.IgnoredStatusContexts {
+		ignored[statusContext] = true
 	}
 
-	_, _, err = svc.Client.PullRequests.Merge(context.Background(), svc.Owner, svc.RepoName, prNumber, "auto-merge", &github.PullRequestOptions{
+	checks := 0
+	pending := false
+	opts := &github.ListOptions{PerPage: svc.perPage()}
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	for {
+		combined, resp, err := svc.Client.Repositories.GetCombinedStatus(ctx, svc.Owner, svc.RepoName, headSHA, opts)
+		if err != nil {
+			return "", fmt.Errorf("error getting combined status: %v", err)
+		}
+		for _, status := range combined.Statuses {
+			if ignored[status.GetContext()] {
+				continue
+			}
+			checks++
+			switch status.GetState() {
+			case "failure", "error":
+				return "failure", nil
+			case "pending":
+				pending = true
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	// GitHub Actions and apps report check runs rather than commit statuses
+	checkRuns, err := svc.ListCheckRunsForRef(headSHA)
+	if err != nil {
+		return "", err
+	}
+	for _, checkRun := range checkRuns {
+		if ignored[checkRun.GetName()] {
+			continue
+		}
+		checks++
+		if checkRun.GetStatus() != "completed" {
+			pending = true
+			continue
+		}
+		switch checkRun.GetConclusion() {
+		case "success", "neutral", "skipped":
+		default:
+			return "failure", nil
+		}
+	}
+
+	if pending || checks == 0 {
+		return "pending", nil
+	}
+	return "success", nil
+}
+
+// MergePullRequest squash-merges the pull request. commitTitle defaults to the PR title when empty, commitMessage
+// defaults to GitHub's generated squash body when empty. When the base branch requires a merge queue, auto-merge is
+// enabled instead so that the pull request goes through the queue. With SquashCoAuthors, the authors of the commits
+// are credited with Co-authored-by trailers appended to commitMessage, which then replaces GitHub's squash body even
+// when empty.
+func (svc *GithubService) MergePullRequest(prNumber int, commitTitle string, commitMessage string) error {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	pr, _, err := svc.Client.PullRequests.Get(ctx, svc.Owner, svc.RepoName, prNumber)
+	if err != nil {
+		return fmt.Errorf("error getting pull request: %w", checkPermissions(err))
+	}
+
+	if commitTitle == "" {
+		commitTitle = pr.GetTitle()
+	}
+	if svc.SquashCoAuthors {
+		commits, err := svc.GetPullRequestCommits(prNumber)
+		if err != nil {
+			return err
+		}
+		commitMessage = appendCoAuthorTrailers(commitMessage, coAuthorTrailers(commits, pr.GetUser().GetLogin()))
+	}
+
+	_, _, err = svc.Client.PullRequests.Merge(ctx, svc.Owner, svc.RepoName, prNumber, commitMessage, &github.PullRequestOptions{
+		CommitTitle: commitTitle,
 		MergeMethod: "squash",
 		SHA:         pr.Head.GetSHA(),
 	})
-	return err
+	if isMergeQueueRequired(err) {
+		log.Printf("PR #%d must go through the merge queue, enabling auto-merge", prNumber)
+		return svc.enableAutoMerge(pr, "squash", commitTitle, commitMessage)
+	}
+	return checkPermissions(err)
+}
+
+// GetPullRequestCommits pages through the commits of a pull request, oldest first
+func (svc *GithubService) GetPullRequestCommits(prNumber int) ([]*github.RepositoryCommit, error) {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	var commits []*github.RepositoryCommit
+	opts := &github.ListOptions{PerPage: svc.perPage()}
+	for {
+		page, resp, err := svc.Client.PullRequests.ListCommits(ctx, svc.Owner, svc.RepoName, prNumber, opts)
+		if err != nil {
+			return nil, fmt.Errorf("error listing commits of PR #%d: %w", prNumber, checkPermissions(err))
+		}
+		commits = append(commits, page...)
+		if resp.NextPage == 0 {
+			return commits, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// coAuthorTrailers returns the unique Co-authored-by trailers crediting the authors of commits other than the pull
+// request author, and the co-authors already credited in the commit messages
+func coAuthorTrailers(commits []*github.RepositoryCommit, prAuthor string) []string {
+	var trailers []string
+	seen := make(map[string]bool)
+	add := func(trailer string) {
+		key := strings.ToLower(trailer)
+		if !seen[key] {
+			seen[key] = true
+			trailers = append(trailers, trailer)
+		}
+	}
+	for _, commit := range commits {
+		author := commit.GetCommit().GetAuthor()
+		if commit.GetAuthor().GetLogin() != prAuthor && author.GetEmail() != "" {
+			add(fmt.Sprintf("Co-authored-by: %v <%v>", author.GetName(), author.GetEmail()))
+		}
+		for _, line := range strings.Split(commit.GetCommit().GetMessage(), "\n") {
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(strings.ToLower(line), "co-authored-by:") {
+				add("Co-authored-by:" + line[len("co-authored-by:"):])
+			}
+		}
+	}
+	return trailers
+}
+
+// appendCoAuthorTrailers appends to message the trailers it doesn't contain yet, separated by a blank line as git
+// expects trailers
+func appendCoAuthorTrailers(message string, trailers []string) string {
+	var missing []string
+	for _, trailer := range trailers {
+		if !strings.Contains(strings.ToLower(message), strings.ToLower(trailer)) {
+			missing = append(missing, trailer)
+		}
+	}
+	if len(missing) == 0 {
+		return message
+	}
+	if message == "" {
+		return strings.Join(missing, "\n")
+	}
+	message = strings.TrimRight(message, "\n")
+	// trailers must all be in the last paragraph
+	paragraphs := strings.Split(message, "\n\n")
+	separator := "\n\n"
+	if isCoAuthorParagraph(paragraphs[len(paragraphs)-1]) {
+		separator = "\n"
+	}
+	return message + separator + strings.Join(missing, "\n")
+}
+
+func isCoAuthorParagraph(paragraph string) bool {
+	for _, line := range strings.Split(paragraph, "\n") {
+		if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(line)), "co-authored-by:") {
+			return false
+		}
+	}
+	return true
 }
 
 func isMergeableState(mergeableState string) bool {
@@ -140,115 +909,267 @@ func isMergeableState(mergeableState string) bool {
 }
 
 func (svc *GithubService) IsMergeable(prNumber int) (bool, error) {
-	pr, _, err := svc.Client.PullRequests.Get(context.Background(), svc.Owner, svc.RepoName, prNumber)
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	pr, _, err := svc.Client.PullRequests.Get(ctx, svc.Owner, svc.RepoName, prNumber)
 	if err != nil {
-		log.Fatalf("error getting pull request: %v", err)
-		return false, err
+		return false, fmt.Errorf("error getting pull request: %w", checkPermissions(err))
 	}
 
 	return pr.GetMergeable() && isMergeableState(pr.GetMergeableState()), nil
 }
 
-func (svc *GithubService) IsMerged(prNumber int) (bool, error) {
-	pr, _, err := svc.Client.PullRequests.Get(context.Background(), svc.Owner, svc.RepoName, prNumber)
+var ErrMergeabilityUnknown = errors.New("mergeability of the pull request is still being computed")
+
+const mergeabilityPollAttempts = 5
+
+// mergeabilityPollInterval is a variable so that tests don't wait
+var mergeabilityPollInterval = 2 * time.Second
+
+// getPullRequestWithMergeability gets the pull request once GitHub computed whether it can be merged, which it does
+// in the background after pushes: mergeable is null and mergeable_state "unknown" in the meantime
+func (svc *GithubService) getPullRequestWithMergeability(prNumber int) (*github.PullRequest, error) {
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := svc.operationContext()
+		pr, _, err := svc.Client.PullRequests.Get(ctx, svc.Owner, svc.RepoName, prNumber)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("error getting pull request: %w", checkPermissions(err))
+		}
+		if pr.Mergeable != nil && pr.GetMergeableState() != "unknown" {
+			return pr, nil
+		}
+		if attempt == mergeabilityPollAttempts {
+			return nil, fmt.Errorf("%w: PR #%d", ErrMergeabilityUnknown, prNumber)
+		}
+		time.Sleep(mergeabilityPollInterval)
+	}
+}
+
+// HasMergeConflicts reports whether the pull request conflicts with its base branch (mergeable state "dirty"), so
+// that runners can warn before applying changes that can't be merged. A pull request "blocked" by reviews or required
+// checks has no conflicts. ErrMergeabilityUnknown is returned when GitHub doesn't compute mergeability in time.
+func (svc *GithubService) HasMergeConflicts(prNumber int) (bool, error) {
+	pr, err := svc.getPullRequestWithMergeability(prNumber)
 	if err != nil {
-		log.Fatalf("error getting pull request: %v", err)
 		return false, err
 	}
+	return strings.ToLower(pr.GetMergeableState()) == "dirty", nil
+}
+
+func (svc *GithubService) IsMerged(prNumber int) (bool, error) {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	pr, _, err := svc.Client.PullRequests.Get(ctx, svc.Owner, svc.RepoName, prNumber)
+	if err != nil {
+		return false, fmt.Errorf("error getting pull request: %w", checkPermissions(err))
+	}
 	return *pr.Merged, nil
 }
 
 func (svc *GithubService) IsClosed(prNumber int) (bool, error) {
-	pr, _, err := svc.Client.PullRequests.Get(context.Background(), svc.Owner, svc.RepoName, prNumber)
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	pr, _, err := svc.Client.PullRequests.Get(ctx, svc.Owner, svc.RepoName, prNumber)
 	if err != nil {
-		log.Fatalf("error getting pull request: %v", err)
-		return false, err
+		return false, fmt.Errorf("error getting pull request: %w", checkPermissions(err))
 	}
 
 	return pr.GetState() == "closed", nil
 }
 
 func (svc *GithubService) GetBranchName(prNumber int) (string, error) {
-	pr, _, err := svc.Client.PullRequests.Get(context.Background(), svc.Owner, svc.RepoName, prNumber)
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	pr, _, err := svc.Client.PullRequests.Get(ctx, svc.Owner, svc.RepoName, prNumber)
 	if err != nil {
-		log.Fatalf("error getting pull request: %v", err)
-		return "", err
+		return "", fmt.Errorf("error getting pull request: %w", checkPermissions(err))
 	}
 	return pr.Head.GetRef(), nil
 }
 
+func (svc *GithubService) GetPullRequestBody(prNumber int) (string, error) {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	pr, _, err := svc.Client.PullRequests.Get(ctx, svc.Owner, svc.RepoName, prNumber)
+	if err != nil {
+		return "", fmt.Errorf("error getting pull request: %w", checkPermissions(err))
+	}
+	return pr.GetBody(), nil
+}
+
+// GetAuthorAssociation returns the relationship of the pull request author with the repository: "OWNER", "MEMBER",
+// "COLLABORATOR", "CONTRIBUTOR", "FIRST_TIME_CONTRIBUTOR", "FIRST_TIMER" or "NONE"
+func (svc *GithubService) GetAuthorAssociation(prNumber int) (string, error) {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	pr, _, err := svc.Client.PullRequests.Get(ctx, svc.Owner, svc.RepoName, prNumber)
+	if err != nil {
+		return "", fmt.Errorf("error getting pull request: %w", checkPermissions(err))
+	}
+	return pr.GetAuthorAssociation(), nil
+}
+
+// IsTrustedAuthorAssociation tells whether authors with this association own the repository, belong to its
+// organisation or are collaborators, pull requests of other authors, e.g. first-time contributors of public repositories, deserve manual approval
+func IsTrustedAuthorAssociation(association string) bool {
+	switch association {
+	case "OWNER", "MEMBER", "COLLABORATOR":
+		return true
+	}
+	return false
+}
+
+// GetBaseAndHeadSHA returns the SHAs of the base and head commits of the pull request in a single API call
+func (svc *GithubService) GetBaseAndHeadSHA(prNumber int) (string, string, error) {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	pr, _, err := svc.Client.PullRequests.Get(ctx, svc.Owner, svc.RepoName, prNumber)
+	if err != nil {
+		return "", "", fmt.Errorf("error getting pull request: %w", checkPermissions(err))
+	}
+	return pr.GetBase().GetSHA(), pr.GetHead().GetSHA(), nil
+}
+
+func (svc *GithubService) GetLatestCommitSHA(prNumber int) (string, error) {
+	_, headSHA, err := svc.GetBaseAndHeadSHA(prNumber)
+	return headSHA, err
+}
+
+// GetCommitMessage returns the message of a commit, e.g. the head of a pull request to check it for a skip token
+func (svc *GithubService) GetCommitMessage(sha string) (string, error) {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	commit, _, err := svc.Client.Git.GetCommit(ctx, svc.Owner, svc.RepoName, sha)
+	if err != nil {
+		return "", fmt.Errorf("error getting commit %v: %w", sha, checkPermissions(err))
+	}
+	return commit.GetMessage(), nil
+}
+
+// IsEventSuperseded reports whether new commits were pushed to the pull request after the event was sent, in which
+// case a later synchronize event will plan the newer head and this one can be skipped
+func (svc *GithubService) IsEventSuperseded(payload *github.PullRequestEvent) (bool, error) {
+	latestSHA, err := svc.GetLatestCommitSHA(payload.GetPullRequest().GetNumber())
+	if err != nil {
+		return false, err
+	}
+	return payload.GetPullRequest().GetHead().GetSHA() != latestSHA, nil
+}
+
+// IsCommandStale reports whether commits were pushed to the pull request since a command was received, commandSHA
+// being the head recorded with GetLatestCommitSHA at that time. Applying a plan of a stale command would apply code
+// nobody planned, runners should refuse and ask for a new plan.
+func (svc *GithubService) IsCommandStale(prNumber int, commandSHA string) (bool, error) {
+	if commandSHA == "" {
+		return false, fmt.Errorf("no head SHA was recorded for the command")
+	}
+	latestSHA, err := svc.GetLatestCommitSHA(prNumber)
+	if err != nil {
+		return false, fmt.Errorf("error getting head of pull request %d: %w", prNumber, checkPermissions(err))
+	}
+	return commandSHA != latestSHA, nil
+}
+
+// ConvertGithubPullRequestEventToJobs converts pull request events to jobs running the commands configured in the
+// workflow of each impacted project for the event. Pull requests closed without being merged to the default branch
+// also get an unlock job per project, unless the configured commands already unlock or are empty.
 func ConvertGithubPullRequestEventToJobs(payload *github.PullRequestEvent, impactedProjects []configuration.Project, requestedProject *configuration.Project, workflows map[string]configuration.Workflow) ([]orchestrator.Job, bool, error) {
 	jobs := make([]orchestrator.Job, 0)
 
+	// skipping only applies to plans, a skipped pull request is still applied once merged
+	action := payload.GetAction()
+	if (action == "opened" || action == "reopened" || action == "synchronize") && orchestrator.ParsePullRequestDirectives(payload.GetPullRequest().GetBody()).Skip {
+		return jobs, true, nil
+	}
+
 	for _, project := range impactedProjects {
 		workflow, ok := workflows[project.Workflow]
 		if !ok {
-			return nil, false, fmt.Errorf("failed to find workflow config '%s' for project '%s'", project.Workflow, project.Name)
+			return nil, false, fmt.Errorf("%w: failed to find workflow config '%s' for project '%s'", orchestrator.ErrWorkflowNotFound, project.Workflow, project.Name)
+		}
+
+		applyStage, err := orchestrator.ToConfigStage(workflow.Apply)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid apply stage in workflow '%s' for project '%s': %v", project.Workflow, project.Name, err)
+		}
+		planStage, err := orchestrator.ToConfigStage(workflow.Plan)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid plan stage in workflow '%s' for project '%s': %v", project.Workflow, project.Name, err)
 		}
 
 		stateEnvVars, commandEnvVars := configuration.CollectTerraformEnvConfig(workflow.EnvVars)
+		commandEnvVars, scopedCommandEnvVars := orchestrator.SplitCommandScopedEnvVars(commandEnvVars)
 		pullRequestNumber := payload.PullRequest.Number
 
+		var commands []string
+		unlock := false
 		if *payload.Action == "closed" && *payload.PullRequest.Merged && *(payload.PullRequest.Base).Ref == *(payload.Repo).DefaultBranch {
-			jobs = append(jobs, orchestrator.Job{
-				ProjectName:       project.Name,
-				ProjectDir:        project.Dir,
-				ProjectWorkspace:  project.Workspace,
-				ProjectWorkflow:   project.Workflow,
-				Terragrunt:        project.Terragrunt,
-				Commands:          workflow.Configuration.OnCommitToDefault,
-				ApplyStage:        orchestrator.ToConfigStage(workflow.Apply),
-				PlanStage:         orchestrator.ToConfigStage(workflow.Plan),
-				CommandEnvVars:    commandEnvVars,
-				StateEnvVars:      stateEnvVars,
-				PullRequestNumber: pullRequestNumber,
-				EventName:         "pull_request",
-				Namespace:         *payload.Repo.FullName,
-				RequestedBy:       *payload.Sender.Login,
-			})
+			commands = workflow.Configuration.OnCommitToDefault
 		} else if *payload.Action == "opened" || *payload.Action == "reopened" || *payload.Action == "synchronize" {
-			jobs = append(jobs, orchestrator.Job{
-				ProjectName:       project.Name,
-				ProjectDir:        project.Dir,
-				ProjectWorkspace:  project.Workspace,
-				ProjectWorkflow:   project.Workflow,
-				Terragrunt:        project.Terragrunt,
-				Commands:          workflow.Configuration.OnPullRequestPushed,
-				ApplyStage:        orchestrator.ToConfigStage(workflow.Apply),
-				PlanStage:         orchestrator.ToConfigStage(workflow.Plan),
-				CommandEnvVars:    commandEnvVars,
-				StateEnvVars:      stateEnvVars,
-				PullRequestNumber: pullRequestNumber,
-				EventName:         "pull_request",
-				Namespace:         *payload.Repo.FullName,
-				RequestedBy:       *payload.Sender.Login,
-			})
+			commands = workflow.Configuration.OnPullRequestPushed
 		} else if *payload.Action == "closed" {
-			jobs = append(jobs, orchestrator.Job{
-				ProjectName:       project.Name,
-				ProjectDir:        project.Dir,
-				ProjectWorkspace:  project.Workspace,
-				ProjectWorkflow:   project.Workflow,
-				Terragrunt:        project.Terragrunt,
-				Commands:          workflow.Configuration.OnPullRequestClosed,
-				ApplyStage:        orchestrator.ToConfigStage(workflow.Apply),
-				PlanStage:         orchestrator.ToConfigStage(workflow.Plan),
-				CommandEnvVars:    commandEnvVars,
-				StateEnvVars:      stateEnvVars,
-				PullRequestNumber: pullRequestNumber,
-				EventName:         "pull_request",
-				Namespace:         *payload.Repo.FullName,
-				RequestedBy:       *payload.Sender.Login,
-			})
+			commands = workflow.Configuration.OnPullRequestClosed
+			// the locks of a pull request that won't be applied would block other pull requests
+			unlock = !containsCommand(commands, "digger unlock")
+		}
+		// an empty command list, e.g. on_pull_request_closed: [], disables the event for the workflow
+		if len(commands) == 0 {
+			continue
+		}
+
+		jobs = append(jobs, orchestrator.Job{
+			ProjectName:          project.Name,
+			ProjectDir:           project.Dir,
+			ProjectWorkspace:     project.Workspace,
+			ProjectWorkflow:      project.Workflow,
+			WorkflowHash:         orchestrator.HashWorkflow(workflow),
+			Terragrunt:           project.Terragrunt,
+			DependsOn:            project.DependencyProjects,
+			Commands:             commands,
+			Action:               orchestrator.JobActionForCommands(commands),
+			ApplyStage:           applyStage,
+			PlanStage:            planStage,
+			CommandEnvVars:       commandEnvVars,
+			ScopedCommandEnvVars: scopedCommandEnvVars,
+			StateEnvVars:         stateEnvVars,
+			PullRequestNumber:    pullRequestNumber,
+			EventName:            "pull_request",
+			Namespace:            *payload.Repo.FullName,
+			RequestedBy:          *payload.Sender.Login,
+		})
+		if unlock {
+			unlockJob := jobs[len(jobs)-1]
+			unlockJob.Commands = []string{"digger unlock"}
+			unlockJob.Action = orchestrator.JobActionUnlock
+			jobs = append(jobs, unlockJob)
 		}
 	}
+	jobs = orchestrator.DeduplicateJobs(jobs)
+	if err := orchestrator.ValidateJobs(jobs); err != nil {
+		return nil, false, fmt.Errorf("invalid job generated: %v", err)
+	}
 	return jobs, true, nil
 }
 
+func containsCommand(commands []string, command string) bool {
+	for _, c := range commands {
+		if strings.TrimSpace(c) == command {
+			return true
+		}
+	}
+	return false
+}
+
+// ConvertGithubIssueCommentEventToJobs converts the built-in commands of orchestrator.DefaultCommandRegistry
 func ConvertGithubIssueCommentEventToJobs(payload *github.IssueCommentEvent, impactedProjects []configuration.Project, requestedProject *configuration.Project, workflows map[string]configuration.Workflow) ([]orchestrator.Job, bool, error) {
-	jobs := make([]orchestrator.Job, 0)
+	return ConvertGithubIssueCommentEventToJobsWithCommands(payload, impactedProjects, requestedProject, workflows, orchestrator.DefaultCommandRegistry())
+}
 
-	supportedCommands := []string{"digger plan", "digger apply", "digger unlock", "digger lock"}
+// ConvertGithubIssueCommentEventToJobsWithCommands converts a comment starting with one of the commands of registry
+// to a job per project, other comments don't generate jobs
+func ConvertGithubIssueCommentEventToJobsWithCommands(payload *github.IssueCommentEvent, impactedProjects []configuration.Project, requestedProject *configuration.Project, workflows map[string]configuration.Workflow, commands orchestrator.CommandRegistry) ([]orchestrator.Job, bool, error) {
+	jobs := make([]orchestrator.Job, 0)
 
 	coversAllImpactedProjects := true
 
@@ -263,73 +1184,297 @@ func ConvertGithubIssueCommentEventToJobs(payload *github.IssueCommentEvent, imp
 		}
 	}
 
-	diggerCommand := strings.ToLower(*payload.Comment.Body)
-	diggerCommand = strings.TrimSpace(diggerCommand)
+	// commands quoted in code blocks are examples, not requests
+	comment := orchestrator.StripCode(*payload.Comment.Body)
+	command, ok := commands.Match(comment)
+	var globalFlags orchestrator.GlobalFlags
+	if ok {
+		flags, err := orchestrator.ParseGlobalFlags(comment)
+		if err != nil {
+			return nil, false, err
+		}
+		globalFlags = flags
+	}
 
-	for _, command := range supportedCommands {
-		if strings.HasPrefix(diggerCommand, command) {
-			for _, project := range runForProjects {
-				workflow, ok := workflows[project.Workflow]
-				if !ok {
-					return nil, false, fmt.Errorf("failed to find workflow config '%s' for project '%s'", project.Workflow, project.Name)
-				}
-				issueNumber := payload.Issue.Number
-				stateEnvVars, commandEnvVars := configuration.CollectTerraformEnvConfig(workflow.EnvVars)
+	if len(runForProjects) == 0 && ok {
+		return jobs, true, fmt.Errorf("%w: %v on PR #%d", orchestrator.ErrNoProjectsImpacted, command, payload.GetIssue().GetNumber())
+	}
 
-				workspace := project.Workspace
-				workspaceOverride, err := orchestrator.ParseWorkspace(*payload.Comment.Body)
-				if err != nil {
-					return []orchestrator.Job{}, false, err
-				}
-				if workspaceOverride != "" {
-					workspace = workspaceOverride
-				}
-				jobs = append(jobs, orchestrator.Job{
-					ProjectName:       project.Name,
-					ProjectDir:        project.Dir,
-					ProjectWorkspace:  workspace,
-					ProjectWorkflow:   project.Workflow,
-					Terragrunt:        project.Terragrunt,
-					Commands:          []string{command},
-					ApplyStage:        orchestrator.ToConfigStage(workflow.Apply),
-					PlanStage:         orchestrator.ToConfigStage(workflow.Plan),
-					CommandEnvVars:    commandEnvVars,
-					StateEnvVars:      stateEnvVars,
-					PullRequestNumber: issueNumber,
-					EventName:         "issue_comment",
-					Namespace:         *payload.Repo.FullName,
-					RequestedBy:       *payload.Sender.Login,
-				})
+	if ok {
+		for _, project := range runForProjects {
+			workflow, ok := workflows[project.Workflow]
+			if !ok {
+				return nil, false, fmt.Errorf("%w: failed to find workflow config '%s' for project '%s'", orchestrator.ErrWorkflowNotFound, project.Workflow, project.Name)
+			}
+			applyStage, err := orchestrator.ToConfigStage(workflow.Apply)
+			if err != nil {
+				return nil, false, fmt.Errorf("invalid apply stage in workflow '%s' for project '%s': %v", project.Workflow, project.Name, err)
+			}
+			planStage, err := orchestrator.ToConfigStage(workflow.Plan)
+			if err != nil {
+				return nil, false, fmt.Errorf("invalid plan stage in workflow '%s' for project '%s': %v", project.Workflow, project.Name, err)
+			}
+			issueNumber := payload.Issue.Number
+			stateEnvVars, commandEnvVars := configuration.CollectTerraformEnvConfig(workflow.EnvVars)
+			commandEnvVars, scopedCommandEnvVars := orchestrator.SplitCommandScopedEnvVars(commandEnvVars)
+
+			workspace := project.Workspace
+			workspaceOverride, err := orchestrator.ParseWorkspace(comment)
+			if err != nil {
+				return []orchestrator.Job{}, false, err
 			}
+			if workspaceOverride != "" {
+				workspace = workspaceOverride
+			}
+			commentEnvVars, err := orchestrator.ParseCommandVariables(comment)
+			if err != nil {
+				return []orchestrator.Job{}, false, err
+			}
+			for name, value := range commentEnvVars {
+				commandEnvVars[name] = value
+			}
+			jobs = append(jobs, orchestrator.Job{
+				ProjectName:          project.Name,
+				ProjectDir:           project.Dir,
+				ProjectWorkspace:     workspace,
+				ProjectWorkflow:      project.Workflow,
+				WorkflowHash:         orchestrator.HashWorkflow(workflow),
+				Terragrunt:           project.Terragrunt,
+				DependsOn:            project.DependencyProjects,
+				Commands:             []string{command},
+				Action:               commands.Action(command),
+				NoColor:              globalFlags.NoColor,
+				Verbose:              globalFlags.Verbose,
+				ApplyStage:           applyStage,
+				PlanStage:            planStage,
+				CommandEnvVars:       commandEnvVars,
+				ScopedCommandEnvVars: scopedCommandEnvVars,
+				StateEnvVars:         stateEnvVars,
+				PullRequestNumber:    issueNumber,
+				EventName:            "issue_comment",
+				Namespace:            *payload.Repo.FullName,
+				RequestedBy:          *payload.Sender.Login,
+			})
 		}
 	}
+	jobs = orchestrator.DeduplicateJobs(jobs)
+	if err := orchestrator.ValidateJobs(jobs); err != nil {
+		return nil, false, fmt.Errorf("invalid job generated: %v", err)
+	}
 	return jobs, coversAllImpactedProjects, nil
 }
 
-func ProcessGitHubEvent(ghEvent interface{}, diggerConfig *configuration.DiggerConfig, ciService orchestrator.PullRequestService) ([]configuration.Project, *configuration.Project, int, error) {
+type ProcessEventOptions struct {
+	// ProjectSelection resolves impacted projects with nested directories, all of them are kept by default
+	ProjectSelection orchestrator.ProjectSelectionStrategy
+	// UseMergeCommitForMergedPullRequests computes the impacted projects of comments on merged pull requests from
+	// the files changed by the merge commit, i.e. what actually landed on the base branch, instead of the pull
+	// request diff which keeps being compared against the moving base branch after the merge
+	UseMergeCommitForMergedPullRequests bool
+	// ProjectGroups maps group names targeted with "group:<name>" comments to project names, a group that isn't
+	// defined here selects the projects located in the directory of that name
+	ProjectGroups map[string][]string
+	// ProjectTags maps project names to the tags selectable with "-tag <tag>" comments
+	ProjectTags map[string][]string
+	// MaxChangedFiles makes events of pull requests changing more files fail with ErrTooManyChangedFiles, 0 means
+	// no limit
+	MaxChangedFiles int
+}
+
+var ErrTooManyChangedFiles = errors.New("too many changed files")
+
+func checkChangedFilesLimit(changedFiles []string, opts ProcessEventOptions) error {
+	if opts.MaxChangedFiles > 0 && len(changedFiles) > opts.MaxChangedFiles {
+		return fmt.Errorf("%w: %d files changed, the limit is %d", ErrTooManyChangedFiles, len(changedFiles), opts.MaxChangedFiles)
+	}
+	return nil
+}
+
+func getCommentEventChangedFiles(ciService orchestrator.PullRequestService, prNumber int, opts ProcessEventOptions) ([]string, error) {
+	if opts.UseMergeCommitForMergedPullRequests {
+		merged, err := ciService.IsMerged(prNumber)
+		if err != nil {
+			return nil, err
+		}
+		if merged {
+			return ciService.GetMergedPullRequestChangedFiles(prNumber)
+		}
+	}
+	return ciService.GetChangedFiles(prNumber)
+}
+
+// DetectEventType tells the type of a GitHub event given as a go-github event or a pointer to one, schedule events
+// are given as models.ScheduleEvent. Other types return EventUnsupported with an
+// error wrapping orchestrator.ErrUnsupportedEvent.
+func DetectEventType(event interface{}) (orchestrator.EventType, error) {
+	switch event.(type) {
+	case github.PullRequestEvent, *github.PullRequestEvent:
+		return orchestrator.EventPullRequest, nil
+	case github.IssueCommentEvent, *github.IssueCommentEvent:
+		return orchestrator.EventIssueComment, nil
+	case github.PullRequestReviewEvent, *github.PullRequestReviewEvent:
+		return orchestrator.EventPullRequestReview, nil
+	case github.PullRequestTargetEvent, *github.PullRequestTargetEvent:
+		return orchestrator.EventPullRequestTarget, nil
+	case github.PullRequestReviewCommentEvent, *github.PullRequestReviewCommentEvent:
+		return orchestrator.EventPullRequestReviewComment, nil
+	case github.PushEvent, *github.PushEvent:
+		return orchestrator.EventPush, nil
+	case models.ScheduleEvent, *models.ScheduleEvent:
+		return orchestrator.EventSchedule, nil
+	case github.WorkflowDispatchEvent, *github.WorkflowDispatchEvent:
+		return orchestrator.EventWorkflowDispatch, nil
+	}
+	return orchestrator.EventUnsupported, fmt.Errorf("%w: %T", orchestrator.ErrUnsupportedEvent, event)
+}
+
+// ExtractPullRequestNumber returns the number of the pull request an event relates to, events are accepted as
+// go-github events or pointers to them. Comments on issues which aren't pull requests and events unrelated to pull
+// requests return an error.
+func ExtractPullRequestNumber(event interface{}) (int, error) {
+	var pullRequest *github.PullRequest
+	switch event := event.(type) {
+	case github.PullRequestEvent:
+		pullRequest = event.GetPullRequest()
+	case *github.PullRequestEvent:
+		pullRequest = event.GetPullRequest()
+	case github.PullRequestReviewEvent:
+		pullRequest = event.GetPullRequest()
+	case *github.PullRequestReviewEvent:
+		pullRequest = event.GetPullRequest()
+	case github.PullRequestReviewCommentEvent:
+		pullRequest = event.GetPullRequest()
+	case *github.PullRequestReviewCommentEvent:
+		pullRequest = event.GetPullRequest()
+	case github.PullRequestTargetEvent:
+		pullRequest = event.GetPullRequest()
+	case *github.PullRequestTargetEvent:
+		pullRequest = event.GetPullRequest()
+	case github.IssueCommentEvent:
+		return issuePullRequestNumber(event.GetIssue())
+	case *github.IssueCommentEvent:
+		return issuePullRequestNumber(event.GetIssue())
+	default:
+		return 0, fmt.Errorf("event type %T doesn't relate to a pull request", event)
+	}
+	if pullRequest == nil {
+		return 0, fmt.Errorf("event has no pull request")
+	}
+	return pullRequest.GetNumber(), nil
+}
+
+// issuePullRequestNumber returns the number of an issue that is a pull request
+func issuePullRequestNumber(issue *github.Issue) (int, error) {
+	if issue == nil {
+		return 0, fmt.Errorf("event has no issue")
+	}
+	if !issue.IsPullRequest() {
+		return 0, fmt.Errorf("issue #%d is not a pull request", issue.GetNumber())
+	}
+	return issue.GetNumber(), nil
+}
+
+// ProcessGitHubEvent returns the projects impacted by an event, the project requested by a comment and the number of
+// the pull request of the event. The projects of push events are those changed by the pushed commits, see
+// PushChangedFiles, and their pull request number is 0.
+func ProcessGitHubEvent(ghEvent interface{}, diggerConfig *configuration.DiggerConfig, ciService orchestrator.PullRequestService, opts ProcessEventOptions) ([]configuration.Project, *configuration.Project, int, error) {
 	var impactedProjects []configuration.Project
 	var prNumber int
 
+	// pointers to events are accepted as DetectEventType does
 	switch event := ghEvent.(type) {
-	case github.PullRequestEvent:
-		prNumber = *event.GetPullRequest().Number
+	case *github.PullRequestEvent:
+		if event != nil {
+			ghEvent = *event
+		}
+	case *github.IssueCommentEvent:
+		if event != nil {
+			ghEvent = *event
+		}
+	case *github.PullRequestReviewEvent:
+		if event != nil {
+			ghEvent = *event
+		}
+	case *github.PullRequestTargetEvent:
+		if event != nil {
+			ghEvent = *event
+		}
+	case *github.PullRequestReviewCommentEvent:
+		if event != nil {
+			ghEvent = *event
+		}
+	case *github.PushEvent:
+		if event != nil {
+			ghEvent = *event
+		}
+	}
+
+	switch event := ghEvent.(type) {
+	case github.PullRequestEvent, github.PullRequestReviewEvent, github.PullRequestTargetEvent:
+		number, err := ExtractPullRequestNumber(event)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		prNumber = number
 		changedFiles, err := ciService.GetChangedFiles(prNumber)
 
 		if err != nil {
 			return nil, nil, 0, fmt.Errorf("could not get changed files")
 		}
+		if err := checkChangedFilesLimit(changedFiles, opts); err != nil {
+			return nil, nil, 0, err
+		}
 
 		impactedProjects = diggerConfig.GetModifiedProjects(changedFiles)
+		impactedProjects = orchestrator.SelectProjects(impactedProjects, changedFiles, opts.ProjectSelection)
 	case github.IssueCommentEvent:
-		prNumber = *event.GetIssue().Number
-		changedFiles, err := ciService.GetChangedFiles(prNumber)
+		number, err := ExtractPullRequestNumber(event)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		prNumber = number
+		changedFiles, err := getCommentEventChangedFiles(ciService, prNumber, opts)
 
 		if err != nil {
 			return nil, nil, 0, fmt.Errorf("could not get changed files")
 		}
+		if err := checkChangedFilesLimit(changedFiles, opts); err != nil {
+			return nil, nil, 0, err
+		}
 
 		impactedProjects = diggerConfig.GetModifiedProjects(changedFiles)
-		requestedProject := orchestrator.ParseProjectName(*event.Comment.Body)
+		impactedProjects = orchestrator.SelectProjects(impactedProjects, changedFiles, opts.ProjectSelection)
+
+		comment := orchestrator.StripCode(*event.Comment.Body)
+		if group := orchestrator.ParseProjectGroup(comment); group != "" {
+			groupProjects, err := orchestrator.ResolveProjectGroup(group, diggerConfig.Projects, opts.ProjectGroups)
+			if err != nil {
+				return nil, nil, 0, err
+			}
+			impactedGroupProjects := make([]configuration.Project, 0)
+			for _, project := range impactedProjects {
+				for _, groupProject := range groupProjects {
+					if project.Name == groupProject.Name {
+						impactedGroupProjects = append(impactedGroupProjects, project)
+						break
+					}
+				}
+			}
+			if len(impactedGroupProjects) == 0 {
+				return nil, nil, 0, fmt.Errorf("no project of group %v is impacted by this PR", group)
+			}
+			return impactedGroupProjects, nil, prNumber, nil
+		}
+
+		if tags, matchAll := orchestrator.ParseTags(comment); len(tags) > 0 {
+			taggedProjects := orchestrator.FilterProjectsByTags(impactedProjects, opts.ProjectTags, tags, matchAll)
+			if len(taggedProjects) == 0 {
+				return nil, nil, 0, fmt.Errorf("%w: no impacted project is tagged with %v", orchestrator.ErrProjectNotImpacted, strings.Join(tags, ", "))
+			}
+			return taggedProjects, nil, prNumber, nil
+		}
+
+		requestedProject := orchestrator.ParseProjectName(comment)
 
 		if requestedProject == "" {
 			return impactedProjects, nil, prNumber, nil
@@ -341,9 +1486,40 @@ func ProcessGitHubEvent(ghEvent interface{}, diggerConfig *configuration.DiggerC
 			}
 		}
 		return nil, nil, 0, fmt.Errorf("requested project not found in modified projects")
+	case github.PullRequestReviewCommentEvent:
+		number, err := ExtractPullRequestNumber(event)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		prNumber = number
+		// only plans can be commented on files, see ConvertGithubPullRequestReviewCommentEventToJobs
+		if _, ok := reviewCommentCommands.Match(orchestrator.StripCode(event.GetComment().GetBody())); !ok {
+			return []configuration.Project{}, nil, prNumber, nil
+		}
+		changedFiles, err := getCommentEventChangedFiles(ciService, prNumber, opts)
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("could not get changed files")
+		}
+		if err := checkChangedFilesLimit(changedFiles, opts); err != nil {
+			return nil, nil, 0, err
+		}
+
+		impactedProjects = diggerConfig.GetModifiedProjects(changedFiles)
+		impactedProjects, err = filterProjectsOfFile(diggerConfig, impactedProjects, event.GetComment().GetPath())
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		return impactedProjects, nil, prNumber, nil
+	case github.PushEvent:
+		changedFiles := PushChangedFiles(&event)
+		if err := checkChangedFilesLimit(changedFiles, opts); err != nil {
+			return nil, nil, 0, err
+		}
+		impactedProjects = diggerConfig.GetModifiedProjects(changedFiles)
+		impactedProjects = orchestrator.SelectProjects(impactedProjects, changedFiles, opts.ProjectSelection)
 
 	default:
-		return nil, nil, 0, fmt.Errorf("unsupported event type")
+		return nil, nil, 0, fmt.Errorf("%w: %T", orchestrator.ErrUnsupportedEvent, ghEvent)
 	}
 	return impactedProjects, nil, prNumber, nil
 }
@@ -437,7 +1613,7 @@ func ProcessGitHubIssueCommentEvent(payload *github.IssueCommentEvent, diggerCon
 		}
 	}
 
-	requestedProject := orchestrator.ParseProjectName(*payload.Comment.Body)
+	requestedProject := orchestrator.ParseProjectName(orchestrator.StripCode(*payload.Comment.Body))
 
 	if requestedProject == "" {
 		return impactedProjects, nil, prNumber, nil
@@ -455,7 +1631,7 @@ func issueCommentEventContainsComment(event interface{}, comment string) bool {
 	switch event.(type) {
 	case github.IssueCommentEvent:
 		event := event.(github.IssueCommentEvent)
-		if strings.Contains(*event.Comment.Body, comment) {
+		if strings.Contains(orchestrator.StripCode(*event.Comment.Body), comment) {
 			return true
 		}
 	}
@@ -463,6 +1639,17 @@ func issueCommentEventContainsComment(event interface{}, comment string) bool {
 }
 
 func CheckIfHelpComment(event interface{}) bool {
+	return CheckIfHelpCommentWithCommands(event, orchestrator.DefaultCommandRegistry())
+}
+
+// CheckIfHelpCommentWithCommands tells whether a comment asks for help, comments starting with a command of registry
+// run that command even if they mention "digger help"
+func CheckIfHelpCommentWithCommands(event interface{}, commands orchestrator.CommandRegistry) bool {
+	if event, ok := event.(github.IssueCommentEvent); ok {
+		if _, isCommand := commands.Match(orchestrator.StripCode(event.GetComment().GetBody())); isCommand {
+			return false
+		}
+	}
 	return issueCommentEventContainsComment(event, "digger help")
 }
 
@@ -1,11 +1,41 @@
 package github
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	configuration "github.com/diggerhq/lib-digger-config"
+	orchestrator "github.com/diggerhq/lib-orchestrator"
+	"github.com/diggerhq/lib-orchestrator/github/models"
+	"github.com/google/go-github/v55/github"
 	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
+// setupTestService returns a service talking to a local server, register API handlers on the returned mux
+func setupTestService(t *testing.T) (GithubService, *http.ServeMux) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client := github.NewClient(nil)
+	baseURL, _ := url.Parse(server.URL + "/")
+	client.BaseURL = baseURL
+	return GithubService{
+		Client:   client,
+		RepoName: "demo",
+		Owner:    "diggerhq",
+	}, mux
+}
+
 func TestFindAllProjectsDependantOnImpactedProjects(t *testing.T) {
 
 	projects := []configuration.Project{
@@ -112,3 +142,2333 @@ func TestFindAllProjectsDependantOnImpactedProjects(t *testing.T) {
 	assert.NotContains(t, projectNames, "k")
 	assert.NotContains(t, projectNames, "b")
 }
+
+func TestConvertGithubPullRequestEventToJobsDeduplicatesProjects(t *testing.T) {
+	action := "opened"
+	prNumber := 1
+	fullName := "diggerhq/demo"
+	login := "user"
+	defaultBranch := "main"
+	payload := &github.PullRequestEvent{
+		Action:      &action,
+		PullRequest: &github.PullRequest{Number: &prNumber},
+		Repo:        &github.Repository{FullName: &fullName, DefaultBranch: &defaultBranch},
+		Sender:      &github.User{Login: &login},
+	}
+
+	// the same project matched twice through overlapping include patterns
+	project := configuration.Project{
+		Name:            "dev",
+		Dir:             "dev",
+		Workflow:        "default",
+		IncludePatterns: []string{"modules/**", "modules/vpc/**"},
+	}
+	impactedProjects := []configuration.Project{project, project}
+	workflows := map[string]configuration.Workflow{
+		"default": {
+			Plan:  &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "plan"}}},
+			Apply: &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "apply"}}},
+			Configuration: &configuration.WorkflowConfiguration{
+				OnPullRequestPushed: []string{"digger plan"},
+			},
+		},
+	}
+
+	jobs, _, err := ConvertGithubPullRequestEventToJobs(payload, impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(jobs))
+	assert.Equal(t, "dev", jobs[0].ProjectName)
+}
+
+func TestGetChangedFilesNormalizesSeparators(t *testing.T) {
+	svc, mux := setupTestService(t)
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"filename": "dev/main.tf"}, {"filename": "prod\\app\\main.tf"}]`)
+	})
+
+	files, err := svc.GetChangedFiles(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dev/main.tf", "prod/app/main.tf"}, files)
+	for _, file := range files {
+		assert.False(t, strings.Contains(file, "\\"))
+	}
+}
+
+func TestGetChangedFilesWithPatch(t *testing.T) {
+	svc, mux := setupTestService(t)
+	svc.PerPage = 1
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `[{"filename": "docs/diagram.png", "status": "added"}]`)
+			return
+		}
+		w.Header().Set("Link", `<`+r.URL.Path+`?page=2>; rel="next"`)
+		fmt.Fprint(w, `[{"filename": "dev/main.tf", "status": "modified", "patch": "@@ -1 +1,2 @@\n+resource \"aws_s3_bucket\" \"logs\" {}"}]`)
+	})
+
+	patches, err := svc.GetChangedFilesWithPatch(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []orchestrator.FilePatch{
+		{Filename: "dev/main.tf", Status: "modified", Patch: "@@ -1 +1,2 @@\n+resource \"aws_s3_bucket\" \"logs\" {}"},
+		{Filename: "docs/diagram.png", Status: "added"},
+	}, patches)
+}
+
+func TestGetChangedFilesSince(t *testing.T) {
+	svc, mux := setupTestService(t)
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 1, "head": {"sha": "new"}, "base": {"sha": "base"}}`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/compare/planned...new", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status": "ahead", "files": [{"filename": "prod/main.tf"}]}`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"filename": "dev/main.tf"}, {"filename": "prod/main.tf"}]`)
+	})
+
+	files, err := svc.GetChangedFilesSince(1, "planned")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"prod/main.tf"}, files)
+
+	files, err = svc.GetChangedFilesSince(1, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dev/main.tf", "prod/main.tf"}, files)
+}
+
+func TestGetChangedDirectories(t *testing.T) {
+	svc, mux := setupTestService(t)
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"filename": "prod/main.tf"}, {"filename": "dev/vars.tf"}, {"filename": "README.md"}, {"filename": "prod/outputs.tf"}, {"filename": "dev\\modules\\vpc\\main.tf"}]`)
+	})
+
+	dirs, err := svc.GetChangedDirectories(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{".", "dev", "dev/modules/vpc", "prod"}, dirs)
+}
+
+func TestForRepositorySharesClient(t *testing.T) {
+	svc, mux := setupTestService(t)
+	svc.PerPage = 10
+	mux.HandleFunc("/repos/diggerhq/infra/pulls/2/files", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "10", r.URL.Query().Get("per_page"))
+		fmt.Fprint(w, `[{"filename": "network/main.tf"}]`)
+	})
+
+	infraSvc := svc.ForRepository("diggerhq", "infra")
+	assert.Same(t, svc.Client, infraSvc.Client)
+	assert.Equal(t, "demo", svc.RepoName)
+
+	files, err := infraSvc.GetChangedFiles(2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"network/main.tf"}, files)
+}
+
+func TestGetChangedFilesGraphQL(t *testing.T) {
+	svc, mux := setupTestService(t)
+	svc.UseGraphQLForChangedFiles = true
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data": {"repository": {"pullRequest": {"files": {"nodes": [{"path": "dev/main.tf"}, {"path": "prod/main.tf"}], "pageInfo": {"hasNextPage": false}}}}}}`)
+	})
+
+	files, err := svc.GetChangedFiles(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dev/main.tf", "prod/main.tf"}, files)
+}
+
+func TestGetChangedFilesGraphQLFallsBackToRest(t *testing.T) {
+	svc, mux := setupTestService(t)
+	svc.UseGraphQLForChangedFiles = true
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"errors": [{"message": "something went wrong"}]}`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"filename": "dev/main.tf"}, {"filename": "prod/main.tf"}]`)
+	})
+
+	files, err := svc.GetChangedFiles(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dev/main.tf", "prod/main.tf"}, files)
+}
+
+func TestGetCommentsPaginatesWithPerPage(t *testing.T) {
+	svc, mux := setupTestService(t)
+	svc.PerPage = 1
+	mux.HandleFunc("/repos/diggerhq/demo/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "1", r.URL.Query().Get("per_page"))
+		switch r.URL.Query().Get("page") {
+		case "", "1":
+			w.Header().Set("Link", fmt.Sprintf(`<%v?page=2>; rel="next"`, r.URL.Path))
+			fmt.Fprint(w, `[{"id": 1, "body": "digger plan"}]`)
+		default:
+			fmt.Fprint(w, `[{"id": 2, "body": "digger apply"}]`)
+		}
+	})
+
+	comments, err := svc.GetComments(1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(comments))
+	assert.Equal(t, int64(2), comments[1].Id)
+	assert.Equal(t, "digger apply", *comments[1].Body)
+}
+
+func TestNewGitHubServiceValidatesParams(t *testing.T) {
+	_, err := NewGitHubService("", "demo", "diggerhq")
+	assert.ErrorContains(t, err, "token")
+
+	_, err = NewGitHubService("token", "demo", "")
+	assert.ErrorContains(t, err, "owner")
+
+	_, err = NewGitHubService("token", "", "diggerhq")
+	assert.ErrorContains(t, err, "repository name")
+
+	svc, err := NewGitHubService("token", "demo", "diggerhq")
+	assert.NoError(t, err)
+	assert.Equal(t, "diggerhq", svc.Owner)
+
+	assert.Panics(t, func() { MustNewGitHubService("", "demo", "diggerhq") })
+}
+
+func TestConvertGithubPullRequestLabelEventToJobs(t *testing.T) {
+	prNumber := 1
+	fullName := "diggerhq/demo"
+	login := "user"
+	labeledEvent := func(action string, label string) *github.PullRequestEvent {
+		return &github.PullRequestEvent{
+			Action:      &action,
+			Label:       &github.Label{Name: &label},
+			PullRequest: &github.PullRequest{Number: &prNumber},
+			Repo:        &github.Repository{FullName: &fullName},
+			Sender:      &github.User{Login: &login},
+		}
+	}
+
+	impactedProjects := []configuration.Project{{Name: "dev", Dir: "dev", Workflow: "default"}}
+	workflows := map[string]configuration.Workflow{
+		"default": {
+			Plan:  &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "plan"}}},
+			Apply: &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "apply"}}},
+			Configuration: &configuration.WorkflowConfiguration{
+				OnPullRequestPushed: []string{"digger plan"},
+			},
+		},
+	}
+	triggers := LabelTriggers{PlanLabel: "digger:plan", ApplyLabel: "digger:apply"}
+
+	jobs, err := ConvertGithubPullRequestLabelEventToJobs(labeledEvent("labeled", "digger:plan"), impactedProjects, workflows, triggers)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(jobs))
+	assert.Equal(t, []string{"digger plan"}, jobs[0].Commands)
+
+	jobs, err = ConvertGithubPullRequestLabelEventToJobs(labeledEvent("unlabeled", "digger:plan"), impactedProjects, workflows, triggers)
+	assert.NoError(t, err)
+	assert.Empty(t, jobs)
+
+	jobs, err = ConvertGithubPullRequestLabelEventToJobs(labeledEvent("labeled", "bug"), impactedProjects, workflows, triggers)
+	assert.NoError(t, err)
+	assert.Empty(t, jobs)
+
+	// the apply label is ignored until authorization is configured
+	jobs, err = ConvertGithubPullRequestLabelEventToJobs(labeledEvent("labeled", "digger:apply"), impactedProjects, workflows, triggers)
+	assert.NoError(t, err)
+	assert.Empty(t, jobs)
+
+	triggers.AuthorizeApply = func(user string) (bool, error) { return user == "user", nil }
+	jobs, err = ConvertGithubPullRequestLabelEventToJobs(labeledEvent("labeled", "digger:apply"), impactedProjects, workflows, triggers)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(jobs))
+	assert.Equal(t, []string{"digger apply"}, jobs[0].Commands)
+
+	triggers.AuthorizeApply = func(user string) (bool, error) { return false, nil }
+	_, err = ConvertGithubPullRequestLabelEventToJobs(labeledEvent("labeled", "digger:apply"), impactedProjects, workflows, triggers)
+	assert.Error(t, err)
+}
+
+func TestDeleteCommentsByMarkerContinuesOnFailure(t *testing.T) {
+	svc, mux := setupTestService(t)
+	mux.HandleFunc("/repos/diggerhq/demo/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id": 1, "body": "<!-- digger -->plan"}, {"id": 2, "body": "lgtm"}, {"id": 3, "body": "<!-- digger -->apply"}, {"id": 4, "body": "<!-- digger -->lock"}]`)
+	})
+	var deletedIds []string
+	mux.HandleFunc("/repos/diggerhq/demo/issues/comments/", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodDelete, r.Method)
+		id := strings.TrimPrefix(r.URL.Path, "/repos/diggerhq/demo/issues/comments/")
+		if id == "3" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		deletedIds = append(deletedIds, id)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	deleted, err := svc.DeleteCommentsByMarker(1, "<!-- digger -->")
+	assert.ErrorContains(t, err, "comment 3")
+	assert.Equal(t, 2, deleted)
+	assert.Equal(t, []string{"1", "4"}, deletedIds)
+}
+
+func TestCreateOrUpdateDriftIssueUpdatesExistingIssue(t *testing.T) {
+	svc, mux := setupTestService(t)
+	mux.HandleFunc("/repos/diggerhq/demo/issues", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		fmt.Fprint(w, `[{"number": 3, "body": "fix <!-- digger-drift-issue -->", "pull_request": {"url": "x"}}, {"number": 5, "body": "old drift\n\n<!-- digger-drift-issue -->"}]`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/issues/5", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPatch, r.Method)
+		fmt.Fprint(w, `{"number": 5}`)
+	})
+
+	number, err := svc.CreateOrUpdateDriftIssue("Drift detected", "dev has drifted")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, number)
+}
+
+func TestOperationTimeout(t *testing.T) {
+	svc, mux := setupTestService(t)
+	svc.OperationTimeout = 50 * time.Millisecond
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+		fmt.Fprint(w, `{"number": 1, "body": "late"}`)
+	})
+
+	_, err := svc.GetPullRequestBody(1)
+	assert.ErrorContains(t, err, "context deadline exceeded")
+}
+
+func TestPublishCommentReportsMissingPermission(t *testing.T) {
+	svc, mux := setupTestService(t)
+	mux.HandleFunc("/repos/diggerhq/demo/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message": "Resource not accessible by personal access token"}`)
+	})
+
+	err := svc.PublishComment(1, "digger plan")
+	assert.ErrorIs(t, err, ErrInsufficientPermissions)
+	assert.ErrorContains(t, err, "issues:write")
+}
+
+func TestCancelCheckRunsOnlyTouchesPrefixedRuns(t *testing.T) {
+	svc, mux := setupTestService(t)
+	mux.HandleFunc("/repos/diggerhq/demo/commits/abc/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"total_count": 3, "check_runs": [
+			{"id": 1, "name": "digger/plan/dev", "status": "in_progress"},
+			{"id": 2, "name": "digger/plan/prod", "status": "completed"},
+			{"id": 3, "name": "lint", "status": "in_progress"}
+		]}`)
+	})
+	var updated []string
+	mux.HandleFunc("/repos/diggerhq/demo/check-runs/", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPatch, r.Method)
+		updated = append(updated, strings.TrimPrefix(r.URL.Path, "/repos/diggerhq/demo/check-runs/"))
+		fmt.Fprint(w, `{"id": 1}`)
+	})
+
+	cancelled, err := svc.CancelCheckRuns("abc", "digger/")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cancelled)
+	assert.Equal(t, []string{"1"}, updated)
+}
+
+func TestWaitForCombinedStatus(t *testing.T) {
+	svc, mux := setupTestService(t)
+	svc.IgnoredStatusContexts = []string{"digger/plan/dev"}
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 1, "head": {"sha": "abc"}, "base": {"sha": "def"}}`)
+	})
+	statuses := `[]`
+	checkRuns := `[]`
+	mux.HandleFunc("/repos/diggerhq/demo/commits/abc/status", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"state": "pending", "statuses": %v}`, statuses)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/commits/abc/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"check_runs": %v}`, checkRuns)
+	})
+
+	// no status and no check run yet
+	state, err := svc.WaitForCombinedStatus(1, nil, time.Millisecond)
+	assert.ErrorContains(t, err, "timed out")
+	assert.Equal(t, "pending", state)
+
+	// only digger's own status, and a check run still in progress
+	statuses = `[{"context": "digger/plan/dev", "state": "failure"}]`
+	checkRuns = `[{"name": "build", "status": "in_progress"}]`
+	state, _ = svc.WaitForCombinedStatus(1, nil, time.Millisecond)
+	assert.Equal(t, "pending", state)
+
+	checkRuns = `[{"name": "build", "status": "completed", "conclusion": "success"}]`
+	state, err = svc.WaitForCombinedStatus(1, []string{"success"}, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, "success", state)
+
+	// a terminal failure stops waiting right away
+	checkRuns = `[{"name": "build", "status": "completed", "conclusion": "failure"}]`
+	state, err = svc.WaitForCombinedStatus(1, []string{"success"}, time.Minute)
+	assert.Error(t, err)
+	assert.Equal(t, "failure", state)
+}
+
+func TestConvertGithubPullRequestEventToJobsSkipsEmptyCommands(t *testing.T) {
+	action := "closed"
+	merged := false
+	prNumber := 1
+	fullName := "diggerhq/demo"
+	login := "user"
+	baseRef := "feature"
+	defaultBranch := "main"
+	payload := &github.PullRequestEvent{
+		Action:      &action,
+		PullRequest: &github.PullRequest{Number: &prNumber, Merged: &merged, Base: &github.PullRequestBranch{Ref: &baseRef}},
+		Repo:        &github.Repository{FullName: &fullName, DefaultBranch: &defaultBranch},
+		Sender:      &github.User{Login: &login},
+	}
+	impactedProjects := []configuration.Project{{Name: "dev", Dir: "dev", Workflow: "default"}}
+	workflows := map[string]configuration.Workflow{
+		"default": {
+			Plan:  &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "plan"}}},
+			Apply: &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "apply"}}},
+			Configuration: &configuration.WorkflowConfiguration{
+				OnPullRequestPushed: []string{"digger plan"},
+				OnPullRequestClosed: []string{},
+				OnCommitToDefault:   []string{},
+			},
+		},
+	}
+
+	jobs, _, err := ConvertGithubPullRequestEventToJobs(payload, impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	assert.Empty(t, jobs)
+}
+
+func TestConvertGithubPullRequestEventToJobsSkipDirective(t *testing.T) {
+	prNumber := 1
+	fullName := "diggerhq/demo"
+	login := "user"
+	body := "Rename the bucket\n\n/digger skip"
+	merged := true
+	defaultBranch := "main"
+	event := func(action string) *github.PullRequestEvent {
+		return &github.PullRequestEvent{
+			Action:      &action,
+			PullRequest: &github.PullRequest{Number: &prNumber, Body: &body, Merged: &merged, Base: &github.PullRequestBranch{Ref: &defaultBranch}},
+			Repo:        &github.Repository{FullName: &fullName, DefaultBranch: &defaultBranch},
+			Sender:      &github.User{Login: &login},
+		}
+	}
+	impactedProjects := []configuration.Project{{Name: "dev", Dir: "dev", Workflow: "default"}}
+	workflows := map[string]configuration.Workflow{
+		"default": {
+			Plan:  &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "plan"}}},
+			Apply: &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "apply"}}},
+			Configuration: &configuration.WorkflowConfiguration{
+				OnPullRequestPushed: []string{"digger plan"},
+				OnCommitToDefault:   []string{"digger apply"},
+			},
+		},
+	}
+
+	jobs, _, err := ConvertGithubPullRequestEventToJobs(event("opened"), impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	assert.Empty(t, jobs)
+
+	jobs, _, err = ConvertGithubPullRequestEventToJobs(event("closed"), impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(jobs))
+	assert.Equal(t, []string{"digger apply"}, jobs[0].Commands)
+}
+
+func TestRequiredPermissionIgnoresRepositoryName(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "https://api.github.com/repos/diggerhq/status-page/issues/1/comments", nil)
+	assert.Equal(t, "issues:write", requiredPermission(req))
+
+	req, _ = http.NewRequest(http.MethodPut, "https://github.example.com/api/v3/repos/diggerhq/merge-queue/pulls/1/merge", nil)
+	assert.Equal(t, "contents:write", requiredPermission(req))
+
+	req, _ = http.NewRequest(http.MethodGet, "https://api.github.com/repos/diggerhq/pulls/commits/abc/status", nil)
+	assert.Equal(t, "statuses:read", requiredPermission(req))
+}
+
+func TestIsMergedReportsMissingPermission(t *testing.T) {
+	svc, mux := setupTestService(t)
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message": "Resource not accessible by personal access token"}`)
+	})
+
+	_, err := svc.IsMerged(1)
+	assert.ErrorIs(t, err, ErrInsufficientPermissions)
+	assert.ErrorContains(t, err, "pull_requests:read")
+}
+
+func TestProcessGitHubEventTooManyChangedFiles(t *testing.T) {
+	svc, mux := setupTestService(t)
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"filename": "dev/main.tf"}, {"filename": "prod/main.tf"}, {"filename": "staging/main.tf"}]`)
+	})
+	prNumber := 1
+	event := github.PullRequestEvent{PullRequest: &github.PullRequest{Number: &prNumber}}
+	diggerConfig := &configuration.DiggerConfig{Projects: []configuration.Project{{Name: "dev", Dir: "dev"}}}
+
+	_, _, _, err := ProcessGitHubEvent(event, diggerConfig, &svc, ProcessEventOptions{MaxChangedFiles: 2})
+	assert.True(t, errors.Is(err, ErrTooManyChangedFiles))
+	assert.ErrorContains(t, err, "3 files changed")
+
+	_, _, _, err = ProcessGitHubEvent(event, diggerConfig, &svc, ProcessEventOptions{MaxChangedFiles: 3})
+	assert.NoError(t, err)
+}
+
+func TestGetCommentEventChangedFilesUsesMergeCommit(t *testing.T) {
+	svc, mux := setupTestService(t)
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 1, "merged": true, "merge_commit_sha": "m1"}`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/commits/m1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"sha": "m1", "files": [{"filename": "dev/main.tf"}]}`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+		// compared against the moving base branch after the merge
+		fmt.Fprint(w, `[{"filename": "dev/main.tf"}, {"filename": "prod/main.tf"}]`)
+	})
+
+	files, err := getCommentEventChangedFiles(&svc, 1, ProcessEventOptions{UseMergeCommitForMergedPullRequests: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dev/main.tf"}, files)
+
+	files, err = getCommentEventChangedFiles(&svc, 1, ProcessEventOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dev/main.tf", "prod/main.tf"}, files)
+}
+
+func TestConvertGithubIssueCommentEventToJobsCommandVariables(t *testing.T) {
+	issueNumber := 1
+	fullName := "diggerhq/demo"
+	login := "user"
+	event := func(body string) *github.IssueCommentEvent {
+		return &github.IssueCommentEvent{
+			Comment: &github.IssueComment{Body: &body},
+			Issue:   &github.Issue{Number: &issueNumber},
+			Repo:    &github.Repository{FullName: &fullName},
+			Sender:  &github.User{Login: &login},
+		}
+	}
+	impactedProjects := []configuration.Project{{Name: "dev", Dir: "dev", Workflow: "default"}}
+	workflows := map[string]configuration.Workflow{
+		"default": {
+			Plan:  &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "plan"}}},
+			Apply: &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "apply"}}},
+		},
+	}
+
+	jobs, _, err := ConvertGithubIssueCommentEventToJobs(event(`digger plan {"var":{"Region":"eu"}}`), impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, "eu", jobs[0].CommandEnvVars["TF_VAR_Region"])
+
+	_, _, err = ConvertGithubIssueCommentEventToJobs(event(`digger plan {"var":`), impactedProjects, nil, workflows)
+	assert.ErrorContains(t, err, "invalid JSON variables")
+}
+
+func TestConvertGithubIssueCommentEventToJobsGlobalFlags(t *testing.T) {
+	issueNumber := 1
+	fullName := "diggerhq/demo"
+	login := "user"
+	event := func(body string) *github.IssueCommentEvent {
+		return &github.IssueCommentEvent{
+			Comment: &github.IssueComment{Body: &body},
+			Issue:   &github.Issue{Number: &issueNumber},
+			Repo:    &github.Repository{FullName: &fullName},
+			Sender:  &github.User{Login: &login},
+		}
+	}
+	impactedProjects := []configuration.Project{{Name: "dev", Dir: "dev", Workflow: "default"}, {Name: "prod", Dir: "prod", Workflow: "default"}}
+	workflows := map[string]configuration.Workflow{"default": {}}
+
+	jobs, _, err := ConvertGithubIssueCommentEventToJobs(event("digger plan -no-color -p dev -verbose"), impactedProjects, &impactedProjects[0], workflows)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, "dev", jobs[0].ProjectName)
+	assert.True(t, jobs[0].NoColor)
+	assert.True(t, jobs[0].Verbose)
+
+	jobs, _, err = ConvertGithubIssueCommentEventToJobs(event("digger plan"), impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 2)
+	assert.False(t, jobs[0].NoColor)
+	assert.False(t, jobs[0].Verbose)
+
+	_, _, err = ConvertGithubIssueCommentEventToJobs(event("digger plan -nocolor"), impactedProjects, nil, workflows)
+	assert.ErrorContains(t, err, "unknown flag -nocolor")
+}
+
+func TestConvertGithubIssueCommentEventToJobsNoProjectsImpacted(t *testing.T) {
+	issueNumber := 1
+	fullName := "diggerhq/demo"
+	login := "user"
+	event := func(body string) *github.IssueCommentEvent {
+		return &github.IssueCommentEvent{
+			Comment: &github.IssueComment{Body: &body},
+			Issue:   &github.Issue{Number: &issueNumber},
+			Repo:    &github.Repository{FullName: &fullName},
+			Sender:  &github.User{Login: &login},
+		}
+	}
+
+	jobs, _, err := ConvertGithubIssueCommentEventToJobs(event("digger plan"), []configuration.Project{}, nil, map[string]configuration.Workflow{})
+	assert.ErrorIs(t, err, orchestrator.ErrNoProjectsImpacted)
+	assert.Empty(t, jobs)
+
+	jobs, _, err = ConvertGithubIssueCommentEventToJobs(event("looks good to me"), []configuration.Project{}, nil, map[string]configuration.Workflow{})
+	assert.NoError(t, err)
+	assert.Empty(t, jobs)
+}
+
+func TestDetectEventType(t *testing.T) {
+	testCases := []struct {
+		event    interface{}
+		expected orchestrator.EventType
+	}{
+		{github.PullRequestEvent{}, orchestrator.EventPullRequest},
+		{&github.PullRequestEvent{}, orchestrator.EventPullRequest},
+		{github.IssueCommentEvent{}, orchestrator.EventIssueComment},
+		{&github.PushEvent{}, orchestrator.EventPush},
+		{models.ScheduleEvent{Schedule: "0 6 * * *"}, orchestrator.EventSchedule},
+		{github.WorkflowDispatchEvent{}, orchestrator.EventWorkflowDispatch},
+		{&github.PullRequestReviewEvent{}, orchestrator.EventPullRequestReview},
+		{github.PullRequestTargetEvent{}, orchestrator.EventPullRequestTarget},
+		{&github.PullRequestReviewCommentEvent{}, orchestrator.EventPullRequestReviewComment},
+	}
+	for _, testCase := range testCases {
+		eventType, err := DetectEventType(testCase.event)
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.expected, eventType)
+	}
+
+	eventType, err := DetectEventType(github.ReleaseEvent{})
+	assert.ErrorContains(t, err, "unsupported event type: github.ReleaseEvent")
+	assert.ErrorIs(t, err, orchestrator.ErrUnsupportedEvent)
+	assert.Equal(t, orchestrator.EventUnsupported, eventType)
+}
+
+func TestProcessGitHubEventUnsupportedEvent(t *testing.T) {
+	diggerConfig := &configuration.DiggerConfig{}
+	var ciService orchestrator.PullRequestService = &GithubService{}
+
+	_, _, _, err := ProcessGitHubEvent(&github.ReleaseEvent{}, diggerConfig, ciService, ProcessEventOptions{})
+	assert.ErrorIs(t, err, orchestrator.ErrUnsupportedEvent)
+	assert.EqualError(t, err, "unsupported event type: *github.ReleaseEvent")
+
+	_, _, _, err = ProcessGitHubEvent(github.WorkflowDispatchEvent{}, diggerConfig, ciService, ProcessEventOptions{})
+	assert.ErrorIs(t, err, orchestrator.ErrUnsupportedEvent)
+	assert.EqualError(t, err, "unsupported event type: github.WorkflowDispatchEvent")
+}
+
+func TestConvertGithubIssueCommentEventToJobsLockActions(t *testing.T) {
+	issueNumber := 1
+	fullName := "diggerhq/demo"
+	login := "user"
+	event := func(body string) *github.IssueCommentEvent {
+		return &github.IssueCommentEvent{
+			Comment: &github.IssueComment{Body: &body},
+			Issue:   &github.Issue{Number: &issueNumber},
+			Repo:    &github.Repository{FullName: &fullName},
+			Sender:  &github.User{Login: &login},
+		}
+	}
+	impactedProjects := []configuration.Project{{Name: "dev", Dir: "dev", Workflow: "default"}}
+	workflows := map[string]configuration.Workflow{
+		"default": {
+			Plan:  &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "plan"}}},
+			Apply: &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "apply"}}},
+		},
+	}
+
+	testCases := map[string]orchestrator.JobAction{
+		"digger lock":   orchestrator.JobActionLock,
+		"digger unlock": orchestrator.JobActionUnlock,
+		"digger plan":   orchestrator.JobActionTerraform,
+		"digger apply":  orchestrator.JobActionTerraform,
+	}
+	for comment, action := range testCases {
+		jobs, _, err := ConvertGithubIssueCommentEventToJobs(event(comment), impactedProjects, nil, workflows)
+		assert.NoError(t, err)
+		if assert.Len(t, jobs, 1, comment) {
+			assert.Equal(t, []string{comment}, jobs[0].Commands)
+			assert.Equal(t, action, jobs[0].Action, comment)
+		}
+	}
+}
+
+func TestConvertGithubIssueCommentEventToJobsWithCustomCommands(t *testing.T) {
+	prNumber := 1
+	fullName := "diggerhq/demo"
+	login := "user"
+	event := func(body string) *github.IssueCommentEvent {
+		return &github.IssueCommentEvent{
+			Comment: &github.IssueComment{Body: &body},
+			Issue:   &github.Issue{Number: &prNumber},
+			Repo:    &github.Repository{FullName: &fullName},
+			Sender:  &github.User{Login: &login},
+		}
+	}
+	impactedProjects := []configuration.Project{{Name: "dev", Dir: "dev", Workflow: "default"}}
+	workflows := map[string]configuration.Workflow{
+		"default": {
+			Plan:  &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "plan"}}},
+			Apply: &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "apply"}}},
+		},
+	}
+
+	jobs, _, err := ConvertGithubIssueCommentEventToJobs(event("digger test"), impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	assert.Empty(t, jobs)
+
+	commands := orchestrator.DefaultCommandRegistry()
+	commands["digger test"] = orchestrator.JobActionTerraform
+	jobs, _, err = ConvertGithubIssueCommentEventToJobsWithCommands(event("digger test"), impactedProjects, nil, workflows, commands)
+	assert.NoError(t, err)
+	if assert.Len(t, jobs, 1) {
+		assert.Equal(t, []string{"digger test"}, jobs[0].Commands)
+		assert.Equal(t, orchestrator.JobActionTerraform, jobs[0].Action)
+	}
+
+	jobs, _, err = EventConverter{Commands: commands}.ConvertToJobs(event("digger test"), impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+}
+
+func TestConvertGithubIssueCommentEventToJobsIgnoresCode(t *testing.T) {
+	prNumber := 1
+	fullName := "diggerhq/demo"
+	login := "user"
+	event := func(body string) *github.IssueCommentEvent {
+		return &github.IssueCommentEvent{
+			Comment: &github.IssueComment{Body: &body},
+			Issue:   &github.Issue{Number: &prNumber},
+			Repo:    &github.Repository{FullName: &fullName},
+			Sender:  &github.User{Login: &login},
+		}
+	}
+	impactedProjects := []configuration.Project{{Name: "dev", Dir: "dev", Workflow: "default"}}
+	workflows := map[string]configuration.Workflow{
+		"default": {
+			Plan:  &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "plan"}}},
+			Apply: &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "apply"}}},
+		},
+	}
+
+	for _, comment := range []string{"```\ndigger apply\n```", "`digger apply` runs once the plan is approved"} {
+		jobs, _, err := ConvertGithubIssueCommentEventToJobs(event(comment), impactedProjects, nil, workflows)
+		assert.NoError(t, err)
+		assert.Empty(t, jobs, comment)
+	}
+
+	jobs, _, err := ConvertGithubIssueCommentEventToJobs(event("digger plan\n```\ndigger apply -w prod\n```"), impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	if assert.Len(t, jobs, 1) {
+		assert.Equal(t, []string{"digger plan"}, jobs[0].Commands)
+		assert.Equal(t, "", jobs[0].ProjectWorkspace)
+	}
+}
+
+func TestCheckIfHelpCommentWithCommands(t *testing.T) {
+	event := func(body string) github.IssueCommentEvent {
+		return github.IssueCommentEvent{Comment: &github.IssueComment{Body: &body}}
+	}
+	assert.True(t, CheckIfHelpComment(event("digger help")))
+	assert.False(t, CheckIfHelpComment(event("digger plan, see digger help for flags")))
+
+	commands := orchestrator.CommandRegistry{"digger test": orchestrator.JobActionTerraform}
+	assert.False(t, CheckIfHelpCommentWithCommands(event("digger test # digger help"), commands))
+	assert.True(t, CheckIfHelpCommentWithCommands(event("digger plan # digger help"), commands))
+}
+
+// commentServer serves comment 7 of diggerhq/demo, overwrite is called after each edit to simulate the edit of another
+// run landing between our read and our write
+func commentServer(t *testing.T, mux *http.ServeMux, body string, overwrite func(edits int, written string) string) *int {
+	edits := 0
+	mux.HandleFunc("/repos/diggerhq/demo/issues/comments/7", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch {
+			var comment github.IssueComment
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&comment))
+			edits++
+			body = overwrite(edits, comment.GetBody())
+			fmt.Fprint(w, `{"id": 7}`)
+			return
+		}
+		encoded, _ := json.Marshal(body)
+		fmt.Fprintf(w, `{"id": 7, "body": %s}`, encoded)
+	})
+	return &edits
+}
+
+func TestUpdateCommentRetriesOnConcurrentEdit(t *testing.T) {
+	svc, mux := setupTestService(t)
+	// another run read the comment before our first edit and writes its own section right after it
+	edits := commentServer(t, mux, "dev: pending\nprod: pending", func(edits int, written string) string {
+		if edits == 1 {
+			return "dev: planned\nprod: pending"
+		}
+		return written
+	})
+	var body string
+
+	err := svc.UpdateComment(7, func(current string) string {
+		body = strings.Replace(current, "prod: pending", "prod: planned", 1)
+		return body
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, *edits)
+	assert.Equal(t, "dev: planned\nprod: planned", body)
+}
+
+func TestUpdateCommentKeepsLaterEditsIncludingOurs(t *testing.T) {
+	svc, mux := setupTestService(t)
+	// another run read the comment after our edit and adds its own section
+	edits := commentServer(t, mux, "dev: pending\nprod: pending", func(edits int, written string) string {
+		return strings.Replace(written, "dev: pending", "dev: planned", 1)
+	})
+
+	err := svc.UpdateComment(7, func(current string) string {
+		return strings.Replace(current, "prod: pending", "prod: planned", 1)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, *edits)
+}
+
+func TestUpdateCommentGivesUpOnConflicts(t *testing.T) {
+	svc, mux := setupTestService(t)
+	edits := commentServer(t, mux, "status", func(edits int, written string) string {
+		return "status"
+	})
+
+	err := svc.UpdateComment(7, func(body string) string { return body + "!" })
+	assert.ErrorIs(t, err, ErrCommentEditConflict)
+	assert.Equal(t, commentUpdateAttempts, *edits)
+}
+
+func TestAcknowledgeCommand(t *testing.T) {
+	svc, mux := setupTestService(t)
+	mux.HandleFunc("/repos/diggerhq/demo/issues/3/comments", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		var comment github.IssueComment
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&comment))
+		assert.Equal(t, "⏳ Running digger plan -p dev…", comment.GetBody())
+		fmt.Fprint(w, `{"id": 42}`)
+	})
+
+	id, err := svc.AcknowledgeCommand(3, " digger plan -p dev\n")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), id)
+}
+
+func TestExtractPullRequestNumber(t *testing.T) {
+	number := 12
+	pullRequest := &github.PullRequest{Number: &number}
+	pullRequestIssue := &github.Issue{Number: &number, PullRequestLinks: &github.PullRequestLinks{}}
+	testCases := []interface{}{
+		github.PullRequestEvent{PullRequest: pullRequest},
+		&github.PullRequestReviewEvent{PullRequest: pullRequest},
+		github.PullRequestReviewCommentEvent{PullRequest: pullRequest},
+		&github.PullRequestTargetEvent{PullRequest: pullRequest},
+		&github.IssueCommentEvent{Issue: pullRequestIssue},
+	}
+	for _, event := range testCases {
+		prNumber, err := ExtractPullRequestNumber(event)
+		assert.NoError(t, err)
+		assert.Equal(t, 12, prNumber)
+	}
+
+	_, err := ExtractPullRequestNumber(github.IssueCommentEvent{Issue: &github.Issue{Number: &number}})
+	assert.ErrorContains(t, err, "issue #12 is not a pull request")
+	_, err = ExtractPullRequestNumber(github.PushEvent{})
+	assert.ErrorContains(t, err, "doesn't relate to a pull request")
+	_, err = ExtractPullRequestNumber(github.PullRequestEvent{})
+	assert.Error(t, err)
+}
+
+func TestConvertGithubPullRequestReviewEventToJobs(t *testing.T) {
+	prNumber := 1
+	fullName := "diggerhq/demo"
+	reviewer := "reviewer"
+	action := "submitted"
+	reviewEvent := func(state string) *github.PullRequestReviewEvent {
+		return &github.PullRequestReviewEvent{
+			Action:      &action,
+			Review:      &github.PullRequestReview{State: &state, User: &github.User{Login: &reviewer}},
+			PullRequest: &github.PullRequest{Number: &prNumber},
+			Repo:        &github.Repository{FullName: &fullName},
+		}
+	}
+
+	impactedProjects := []configuration.Project{{Name: "dev", Dir: "dev", Workflow: "default"}}
+	workflows := map[string]configuration.Workflow{
+		"default": {
+			Plan:  &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "plan"}}},
+			Apply: &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "apply"}}},
+		},
+	}
+	triggers := ReviewTriggers{AuthorizeApply: func(user string) (bool, error) { return user == "reviewer", nil }}
+
+	// approvals don't apply unless enabled
+	jobs, err := ConvertGithubPullRequestReviewEventToJobs(reviewEvent("approved"), impactedProjects, workflows, triggers)
+	assert.NoError(t, err)
+	assert.Empty(t, jobs)
+
+	triggers.ApplyOnApproval = true
+	jobs, err = ConvertGithubPullRequestReviewEventToJobs(reviewEvent("approved"), impactedProjects, workflows, triggers)
+	assert.NoError(t, err)
+	if assert.Len(t, jobs, 1) {
+		assert.Equal(t, []string{"digger apply"}, jobs[0].Commands)
+		assert.Equal(t, "pull_request_review", jobs[0].EventName)
+		assert.Equal(t, "reviewer", jobs[0].RequestedBy)
+	}
+
+	for _, state := range []string{"commented", "changes_requested"} {
+		jobs, err = ConvertGithubPullRequestReviewEventToJobs(reviewEvent(state), impactedProjects, workflows, triggers)
+		assert.NoError(t, err)
+		assert.Empty(t, jobs)
+	}
+
+	triggers.AuthorizeApply = func(user string) (bool, error) { return false, nil }
+	_, err = ConvertGithubPullRequestReviewEventToJobs(reviewEvent("APPROVED"), impactedProjects, workflows, triggers)
+	assert.ErrorContains(t, err, "not allowed to apply")
+}
+
+func TestSetStatuses(t *testing.T) {
+	svc, mux := setupTestService(t)
+	svc.StatusConcurrency = 2
+	var pullRequestReads, statuses, running, maxRunning int32
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&pullRequestReads, 1)
+		fmt.Fprint(w, `{"number": 1, "head": {"sha": "abc"}, "base": {"sha": "def"}}`)
+	})
+	var rateLimited sync.Once
+	mux.HandleFunc("/repos/diggerhq/demo/statuses/abc", func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			observed := atomic.LoadInt32(&maxRunning)
+			if current <= observed || atomic.CompareAndSwapInt32(&maxRunning, observed, current) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		limited := false
+		rateLimited.Do(func() { limited = true })
+		if limited {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message": "You have exceeded a secondary rate limit", "documentation_url": "https://docs.github.com/rest/overview/resources-in-the-rest-api#secondary-rate-limits"}`)
+			return
+		}
+		atomic.AddInt32(&statuses, 1)
+		fmt.Fprint(w, `{}`)
+	})
+
+	var updates []StatusUpdate
+	for _, project := range []string{"a", "b", "c", "d", "e"} {
+		updates = append(updates, StatusUpdate{Status: orchestrator.PlanPending, StatusContext: orchestrator.StatusContext("plan", project)})
+	}
+	err := svc.SetStatuses(1, updates)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), pullRequestReads)
+	assert.Equal(t, int32(5), statuses)
+	assert.LessOrEqual(t, maxRunning, int32(2))
+}
+
+func TestConvertGithubPullRequestEventToJobsUnlocksOnClose(t *testing.T) {
+	action := "closed"
+	merged := false
+	prNumber := 1
+	fullName := "diggerhq/demo"
+	login := "user"
+	baseRef := "main"
+	payload := &github.PullRequestEvent{
+		Action:      &action,
+		PullRequest: &github.PullRequest{Number: &prNumber, Merged: &merged, Base: &github.PullRequestBranch{Ref: &baseRef}},
+		Repo:        &github.Repository{FullName: &fullName, DefaultBranch: &baseRef},
+		Sender:      &github.User{Login: &login},
+	}
+	impactedProjects := []configuration.Project{{Name: "dev", Dir: "dev", Workflow: "notify"}, {Name: "prod", Dir: "prod", Workflow: "default"}}
+	workflow := func(onClosed []string) configuration.Workflow {
+		return configuration.Workflow{
+			Plan:          &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "plan"}}},
+			Apply:         &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "apply"}}},
+			Configuration: &configuration.WorkflowConfiguration{OnPullRequestClosed: onClosed},
+		}
+	}
+	workflows := map[string]configuration.Workflow{
+		"notify":  workflow([]string{"digger plan"}),
+		"default": workflow([]string{"digger unlock"}),
+	}
+
+	jobs, _, err := ConvertGithubPullRequestEventToJobs(payload, impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	if assert.Len(t, jobs, 3) {
+		assert.Equal(t, "dev", jobs[0].ProjectName)
+		assert.Equal(t, []string{"digger plan"}, jobs[0].Commands)
+		assert.Equal(t, orchestrator.JobActionTerraform, jobs[0].Action)
+		assert.Equal(t, "dev", jobs[1].ProjectName)
+		assert.Equal(t, []string{"digger unlock"}, jobs[1].Commands)
+		assert.Equal(t, orchestrator.JobActionUnlock, jobs[1].Action)
+		assert.Equal(t, "prod", jobs[2].ProjectName)
+		assert.Equal(t, []string{"digger unlock"}, jobs[2].Commands)
+		assert.Equal(t, orchestrator.JobActionUnlock, jobs[2].Action)
+	}
+}
+
+func TestGetUserTeams(t *testing.T) {
+	svc, mux := setupTestService(t)
+	mux.HandleFunc("/orgs/diggerhq/teams", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"name": "Platform", "slug": "platform"}, {"name": "Security", "slug": "security"}, {"name": "Web", "slug": "web"}]`)
+	})
+	mux.HandleFunc("/orgs/diggerhq/teams/platform/memberships/alice", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"state": "active", "role": "member"}`)
+	})
+	mux.HandleFunc("/orgs/diggerhq/teams/security/memberships/alice", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"state": "pending", "role": "member"}`)
+	})
+	mux.HandleFunc("/orgs/diggerhq/teams/web/memberships/alice", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "Not Found"}`)
+	})
+
+	teams, err := svc.GetUserTeams("diggerhq", "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Platform"}, teams)
+
+	teams, err = svc.GetUserTeamsIn("diggerhq", "alice", []string{"web", "platform"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"platform"}, teams)
+
+	member, err := svc.IsUserInTeam("diggerhq", "web", "alice")
+	assert.NoError(t, err)
+	assert.False(t, member)
+}
+
+func TestGetUserTeamsCache(t *testing.T) {
+	svc, mux := setupTestService(t)
+	svc.TeamCache = NewTeamCache(50 * time.Millisecond)
+	listed := 0
+	mux.HandleFunc("/orgs/diggerhq/teams", func(w http.ResponseWriter, r *http.Request) {
+		listed++
+		fmt.Fprint(w, `[{"name": "Platform", "slug": "platform"}]`)
+	})
+	mux.HandleFunc("/orgs/diggerhq/teams/platform/memberships/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"state": "active"}`)
+	})
+
+	for i := 0; i < 3; i++ {
+		teams, err := svc.GetUserTeams("diggerhq", "alice")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Platform"}, teams)
+	}
+	assert.Equal(t, 1, listed)
+
+	// users are cached separately
+	_, err := svc.GetUserTeams("diggerhq", "bob")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, listed)
+
+	time.Sleep(60 * time.Millisecond)
+	_, err = svc.GetUserTeams("diggerhq", "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, listed)
+}
+
+func TestMergePullRequestFallsBackToAutoMergeWithMergeQueue(t *testing.T) {
+	svc, mux := setupTestService(t)
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 1, "node_id": "PR_node", "title": "Add bucket", "head": {"sha": "abc"}}`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1/merge", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		fmt.Fprint(w, `{"message": "Changes must be made through the merge queue"}`)
+	})
+	var variables map[string]interface{}
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		var request graphQLRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		assert.Contains(t, request.Query, "enablePullRequestAutoMerge")
+		variables = request.Variables
+		fmt.Fprint(w, `{"data": {"enablePullRequestAutoMerge": {"clientMutationId": null}}}`)
+	})
+
+	err := svc.MergePullRequest(1, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"pullRequestId": "PR_node", "mergeMethod": "SQUASH", "commitHeadline": "Add bucket"}, variables)
+
+	err = svc.EnableAutoMerge(1, "rebase")
+	assert.NoError(t, err)
+	assert.Equal(t, "REBASE", variables["mergeMethod"])
+
+	err = svc.EnableAutoMerge(1, "fast-forward")
+	assert.ErrorContains(t, err, "unsupported merge method")
+}
+
+func TestSetJobResultStatuses(t *testing.T) {
+	svc, mux := setupTestService(t)
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 1, "head": {"sha": "abc"}, "base": {"sha": "def"}}`)
+	})
+	var mu sync.Mutex
+	states := make(map[string]string)
+	descriptions := make(map[string]string)
+	mux.HandleFunc("/repos/diggerhq/demo/statuses/abc", func(w http.ResponseWriter, r *http.Request) {
+		var status github.RepoStatus
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&status))
+		mu.Lock()
+		states[status.GetContext()] = status.GetState()
+		descriptions[status.GetContext()] = status.GetDescription()
+		mu.Unlock()
+		fmt.Fprint(w, `{}`)
+	})
+
+	err := svc.SetJobResultStatuses(1, []orchestrator.JobResult{
+		{Project: "dev", Command: "digger plan", Status: orchestrator.PlanSucceeded},
+		{Project: "prod", Command: "digger plan", Status: orchestrator.PlanSucceeded, Error: errors.New("provider crashed")},
+		{Project: "staging", Command: "digger plan", Status: orchestrator.PlanPending},
+	}, "digger")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"digger/plan/dev":     "success",
+		"digger/plan/prod":    "failure",
+		"digger/plan/staging": "pending",
+		"digger":              "failure",
+	}, states)
+	assert.Equal(t, "1 of 3 projects failed", descriptions["digger"])
+}
+
+func TestCreateCommitComment(t *testing.T) {
+	svc, mux := setupTestService(t)
+	mux.HandleFunc("/repos/diggerhq/demo/commits/abc/comments", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		var comment map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&comment))
+		assert.Equal(t, map[string]interface{}{"body": "Drift detected in dev"}, comment)
+		fmt.Fprint(w, `{"id": 5}`)
+	})
+
+	id, err := svc.CreateCommitComment("abc", "Drift detected in dev")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), id)
+}
+
+func TestIsCommandStale(t *testing.T) {
+	svc, mux := setupTestService(t)
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 1, "head": {"sha": "new"}, "base": {"sha": "base"}}`)
+	})
+
+	stale, err := svc.IsCommandStale(1, "new")
+	assert.NoError(t, err)
+	assert.False(t, stale)
+
+	stale, err = svc.IsCommandStale(1, "old")
+	assert.NoError(t, err)
+	assert.True(t, stale)
+
+	_, err = svc.IsCommandStale(1, "")
+	assert.Error(t, err)
+}
+
+func TestEventConverter(t *testing.T) {
+	prNumber := 1
+	fullName := "diggerhq/demo"
+	login := "user"
+	impactedProjects := []configuration.Project{{Name: "dev", Dir: "dev", Workflow: "default"}}
+	workflows := map[string]configuration.Workflow{
+		"default": {
+			Plan:  &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "plan"}}},
+			Apply: &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "apply"}}},
+			Configuration: &configuration.WorkflowConfiguration{
+				OnPullRequestPushed: []string{"digger plan"},
+			},
+		},
+	}
+	var converter orchestrator.EventConverter = EventConverter{LabelTriggers: LabelTriggers{PlanLabel: "digger:plan"}}
+
+	opened := "opened"
+	jobs, coversAll, err := converter.ConvertToJobs(github.PullRequestEvent{
+		Action:      &opened,
+		PullRequest: &github.PullRequest{Number: &prNumber},
+		Repo:        &github.Repository{FullName: &fullName},
+		Sender:      &github.User{Login: &login},
+	}, impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	assert.True(t, coversAll)
+	assert.Len(t, jobs, 1)
+
+	labeled := "labeled"
+	label := "digger:plan"
+	jobs, _, err = converter.ConvertToJobs(&github.PullRequestEvent{
+		Action:      &labeled,
+		Label:       &github.Label{Name: &label},
+		PullRequest: &github.PullRequest{Number: &prNumber},
+		Repo:        &github.Repository{FullName: &fullName},
+		Sender:      &github.User{Login: &login},
+	}, impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+
+	body := "digger apply"
+	jobs, _, err = converter.ConvertToJobs(&github.IssueCommentEvent{
+		Comment: &github.IssueComment{Body: &body},
+		Issue:   &github.Issue{Number: &prNumber},
+		Repo:    &github.Repository{FullName: &fullName},
+		Sender:  &github.User{Login: &login},
+	}, impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	if assert.Len(t, jobs, 1) {
+		assert.Equal(t, []string{"digger apply"}, jobs[0].Commands)
+	}
+
+	_, _, err = converter.ConvertToJobs(github.ReleaseEvent{}, impactedProjects, nil, workflows)
+	assert.ErrorContains(t, err, "unsupported event type: github.ReleaseEvent")
+	assert.ErrorIs(t, err, orchestrator.ErrUnsupportedEvent)
+}
+
+func TestListInstallationRepositories(t *testing.T) {
+	svc, mux := setupTestService(t)
+	mux.HandleFunc("/installation/repositories", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `{"total_count": 2, "repositories": [{"name": "infra", "owner": {"login": "diggerhq"}, "default_branch": "develop"}]}`)
+			return
+		}
+		w.Header().Set("Link", fmt.Sprintf(`<%v?page=2>; rel="next"`, r.URL.Path))
+		fmt.Fprint(w, `{"total_count": 2, "repositories": [{"name": "demo", "owner": {"login": "diggerhq"}, "default_branch": "main"}]}`)
+	})
+
+	repositories, err := svc.ListInstallationRepositories()
+	assert.NoError(t, err)
+	assert.Equal(t, []orchestrator.Repository{
+		{Owner: "diggerhq", Name: "demo", DefaultBranch: "main"},
+		{Owner: "diggerhq", Name: "infra", DefaultBranch: "develop"},
+	}, repositories)
+}
+
+func TestSetCommandOutcomeReaction(t *testing.T) {
+	svc, mux := setupTestService(t)
+	var created []string
+	var deleted []string
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"login": "digger-bot"}`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/issues/comments/7/reactions", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			assert.Equal(t, "eyes", r.URL.Query().Get("content"))
+			fmt.Fprint(w, `[{"id": 2, "content": "eyes", "user": {"login": "alice"}}, {"id": 3, "content": "eyes", "user": {"login": "digger-bot"}}]`)
+			return
+		}
+		var reaction struct {
+			Content string `json:"content"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&reaction))
+		created = append(created, reaction.Content)
+		fmt.Fprintf(w, `{"id": 4, "content": %q}`, reaction.Content)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/issues/comments/7/reactions/3", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodDelete, r.Method)
+		deleted = append(deleted, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	assert.NoError(t, svc.SetCommandOutcomeReaction(7, true))
+	assert.Equal(t, []string{"+1"}, created)
+	assert.Len(t, deleted, 1)
+
+	created = nil
+	assert.NoError(t, svc.SetCommandOutcomeReaction(7, false))
+	assert.Equal(t, []string{"-1"}, created)
+}
+
+func TestSetCommandOutcomeReactionWithoutInProgressReaction(t *testing.T) {
+	svc, mux := setupTestService(t)
+	svc.Login = "github-actions[bot]"
+	var created []string
+	mux.HandleFunc("/repos/diggerhq/demo/issues/comments/7/reactions", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, `[{"id": 2, "content": "eyes", "user": {"login": "alice"}}]`)
+			return
+		}
+		var reaction struct {
+			Content string `json:"content"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&reaction))
+		created = append(created, reaction.Content)
+		fmt.Fprintf(w, `{"id": 4, "content": %q}`, reaction.Content)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/issues/comments/7/reactions/2", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the in progress reaction of another user must not be deleted")
+	})
+
+	assert.NoError(t, svc.SetCommandOutcomeReaction(7, true))
+	assert.Equal(t, []string{"+1"}, created)
+}
+
+func TestEventConverterFallbackWorkflow(t *testing.T) {
+	prNumber := 1
+	fullName := "diggerhq/demo"
+	login := "user"
+	body := "digger plan"
+	event := &github.IssueCommentEvent{
+		Comment: &github.IssueComment{Body: &body},
+		Issue:   &github.Issue{Number: &prNumber},
+		Repo:    &github.Repository{FullName: &fullName},
+		Sender:  &github.User{Login: &login},
+	}
+	impactedProjects := []configuration.Project{{Name: "dev", Dir: "dev", Workflow: "missing"}}
+	workflows := map[string]configuration.Workflow{
+		"default": {
+			Plan:  &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "plan"}}},
+			Apply: &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "apply"}}},
+		},
+	}
+
+	_, _, err := EventConverter{}.ConvertToJobs(event, impactedProjects, nil, workflows)
+	assert.ErrorIs(t, err, orchestrator.ErrWorkflowNotFound)
+
+	jobs, _, err := EventConverter{FallbackWorkflow: "default"}.ConvertToJobs(event, impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	if assert.Len(t, jobs, 1) {
+		assert.Equal(t, "missing", jobs[0].ProjectWorkflow)
+		assert.Equal(t, orchestrator.HashWorkflow(workflows["default"]), jobs[0].WorkflowHash)
+	}
+}
+
+func TestUpsertSummaryComment(t *testing.T) {
+	svc, mux := setupTestService(t)
+	var comments []string
+	mux.HandleFunc("/repos/diggerhq/demo/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			var comment github.IssueComment
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&comment))
+			comments = append(comments, comment.GetBody())
+			fmt.Fprint(w, `{"id": 5}`)
+			return
+		}
+		var existing []map[string]interface{}
+		for i, body := range comments {
+			existing = append(existing, map[string]interface{}{"id": 5 + i, "body": body})
+		}
+		assert.NoError(t, json.NewEncoder(w).Encode(existing))
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/issues/comments/5", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPatch, r.Method)
+		var comment github.IssueComment
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&comment))
+		comments[0] = comment.GetBody()
+		fmt.Fprint(w, `{"id": 5}`)
+	})
+
+	id, err := svc.UpsertSummaryComment(1, orchestrator.SummaryData{Rows: []orchestrator.SummaryRow{
+		{ProjectName: "dev", Command: "digger plan", Status: orchestrator.PlanPending},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), id)
+
+	id, err = svc.UpsertSummaryComment(1, orchestrator.SummaryData{Rows: []orchestrator.SummaryRow{
+		{ProjectName: "dev", Command: "digger plan", Status: orchestrator.PlanSucceeded},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), id)
+	if assert.Len(t, comments, 1) {
+		assert.Contains(t, comments[0], "| dev | `digger plan` | Plan succeeded |")
+	}
+}
+
+func TestHasRequiredApprovals(t *testing.T) {
+	svc, mux := setupTestService(t)
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 1, "base": {"ref": "main"}}`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/2", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 2, "base": {"ref": "feature"}}`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/branches/main/protection", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"required_pull_request_reviews": {"required_approving_review_count": 2}}`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/branches/feature/protection", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "Branch not protected"}`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1/reviews", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"user": {"login": "alice"}, "state": "APPROVED"},
+			{"user": {"login": "bob"}, "state": "APPROVED"},
+			{"user": {"login": "bob"}, "state": "CHANGES_REQUESTED"},
+			{"user": {"login": "alice"}, "state": "COMMENTED"}
+		]`)
+	})
+
+	count, err := svc.GetRequiredApprovingReviewCount("main")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	count, err = svc.GetRequiredApprovingReviewCount("feature")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	approved, err := svc.HasRequiredApprovals(1)
+	assert.NoError(t, err)
+	assert.False(t, approved)
+
+	approved, err = svc.HasRequiredApprovals(2)
+	assert.NoError(t, err)
+	assert.True(t, approved)
+}
+
+func TestGetStatusForContext(t *testing.T) {
+	svc, mux := setupTestService(t)
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 1, "head": {"sha": "abc"}, "base": {"sha": "def"}}`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/commits/abc/status", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"state": "pending", "statuses": [{"context": "digger/plan/dev", "state": "success"}, {"context": "ci/build", "state": "pending"}]}`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/commits/abc/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"total_count": 1, "check_runs": [{"name": "digger/plan/prod", "status": "completed", "conclusion": "failure"}]}`)
+	})
+
+	state, err := svc.GetStatusForContext(1, "digger/plan/dev")
+	assert.NoError(t, err)
+	assert.Equal(t, "success", state)
+
+	state, err = svc.GetStatusForContext(1, "digger/plan/prod")
+	assert.NoError(t, err)
+	assert.Equal(t, "failure", state)
+
+	_, err = svc.GetStatusForContext(1, "digger/plan/staging")
+	assert.ErrorIs(t, err, ErrStatusContextNotFound)
+}
+
+func TestGetCommentsSince(t *testing.T) {
+	svc, mux := setupTestService(t)
+	since := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	mux.HandleFunc("/repos/diggerhq/demo/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "2023-09-01T12:00:00Z", r.URL.Query().Get("since"))
+		fmt.Fprint(w, `[{"id": 9, "body": "digger plan"}]`)
+	})
+
+	comments, err := svc.GetCommentsSince(1, since)
+	assert.NoError(t, err)
+	if assert.Len(t, comments, 1) {
+		assert.Equal(t, int64(9), comments[0].Id)
+		assert.Equal(t, "digger plan", *comments[0].Body)
+	}
+}
+
+func TestHasSuccessfulPlan(t *testing.T) {
+	svc, mux := setupTestService(t)
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 1, "head": {"sha": "abc"}, "base": {"sha": "def"}}`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/commits/abc/status", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"state": "failure", "statuses": [{"context": "digger/plan/dev", "state": "success"}, {"context": "digger/plan/prod", "state": "failure"}]}`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/commits/abc/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"total_count": 0, "check_runs": []}`)
+	})
+
+	for project, expected := range map[string]bool{"dev": true, "prod": false, "staging": false} {
+		planned, err := svc.HasSuccessfulPlan(1, project)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, planned, project)
+	}
+}
+
+func TestEventConverterRequiresSuccessfulPlan(t *testing.T) {
+	prNumber := 1
+	fullName := "diggerhq/demo"
+	login := "user"
+	event := func(body string) *github.IssueCommentEvent {
+		return &github.IssueCommentEvent{
+			Comment: &github.IssueComment{Body: &body},
+			Issue:   &github.Issue{Number: &prNumber},
+			Repo:    &github.Repository{FullName: &fullName},
+			Sender:  &github.User{Login: &login},
+		}
+	}
+	impactedProjects := []configuration.Project{{Name: "dev", Dir: "dev", Workflow: "default"}}
+	workflows := map[string]configuration.Workflow{
+		"default": {
+			Plan:  &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "plan"}}},
+			Apply: &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "apply"}}},
+		},
+	}
+	planned := false
+	converter := EventConverter{HasSuccessfulPlan: func(number int, project string) (bool, error) {
+		assert.Equal(t, 1, number)
+		assert.Equal(t, "dev", project)
+		return planned, nil
+	}}
+
+	jobs, _, err := converter.ConvertToJobs(event("digger plan"), impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+
+	_, _, err = converter.ConvertToJobs(event("digger apply"), impactedProjects, nil, workflows)
+	assert.ErrorIs(t, err, ErrPlanRequired)
+
+	planned = true
+	jobs, _, err = converter.ConvertToJobs(event("digger apply"), impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+}
+
+func TestConvertGithubPullRequestEventToJobsWithAutoApply(t *testing.T) {
+	action := "synchronize"
+	prNumber := 1
+	fullName := "diggerhq/demo"
+	login := "user"
+	payload := &github.PullRequestEvent{
+		Action:      &action,
+		PullRequest: &github.PullRequest{Number: &prNumber},
+		Repo:        &github.Repository{FullName: &fullName},
+		Sender:      &github.User{Login: &login},
+	}
+	impactedProjects := []configuration.Project{
+		{Name: "dev", Dir: "dev", Workflow: "default"},
+		{Name: "prod", Dir: "prod", Workflow: "default"},
+	}
+	workflows := map[string]configuration.Workflow{
+		"default": {
+			Plan:  &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "plan"}}},
+			Apply: &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "apply"}}},
+			Configuration: &configuration.WorkflowConfiguration{
+				OnPullRequestPushed: []string{"digger plan"},
+			},
+		},
+	}
+	commandsByProject := func(jobs []orchestrator.Job) map[string][]string {
+		commands := make(map[string][]string)
+		for _, job := range jobs {
+			commands[job.ProjectName] = job.Commands
+		}
+		return commands
+	}
+
+	jobs, _, err := ConvertGithubPullRequestEventToJobsWithAutoApply(payload, impactedProjects, nil, workflows, AutoApply{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"dev": {"digger plan"}, "prod": {"digger plan"}}, commandsByProject(jobs))
+
+	authorized := false
+	autoApply := AutoApply{
+		Enabled:  true,
+		Projects: []string{"dev"},
+		AuthorizeApply: func(user string) (bool, error) {
+			assert.Equal(t, "user", user)
+			return authorized, nil
+		},
+	}
+	jobs, _, err = ConvertGithubPullRequestEventToJobsWithAutoApply(payload, impactedProjects, nil, workflows, autoApply)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"dev": {"digger plan"}, "prod": {"digger plan"}}, commandsByProject(jobs))
+
+	authorized = true
+	jobs, _, err = EventConverter{AutoApply: autoApply}.ConvertToJobs(payload, impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"dev": {"digger plan", "digger apply"}, "prod": {"digger plan"}}, commandsByProject(jobs))
+	assert.Equal(t, []string{"digger plan"}, workflows["default"].Configuration.OnPullRequestPushed)
+	for _, job := range jobs {
+		assert.Equal(t, orchestrator.JobActionTerraform, job.Action)
+	}
+}
+
+func TestStoreAndLoadPlanArtifacts(t *testing.T) {
+	svc, mux := setupTestService(t)
+	var body *string
+	mux.HandleFunc("/repos/diggerhq/demo/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			var comment github.IssueComment
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&comment))
+			body = comment.Body
+			fmt.Fprint(w, `{"id": 5}`)
+			return
+		}
+		if body == nil {
+			fmt.Fprint(w, `[]`)
+			return
+		}
+		assert.NoError(t, json.NewEncoder(w).Encode([]github.IssueComment{{ID: github.Int64(5), Body: body}}))
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/issues/comments/5", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch {
+			var comment github.IssueComment
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&comment))
+			body = comment.Body
+		}
+		assert.NoError(t, json.NewEncoder(w).Encode(github.IssueComment{ID: github.Int64(5), Body: body}))
+	})
+
+	previous, err := svc.LoadPreviousPlan(1, "dev")
+	assert.NoError(t, err)
+	assert.Nil(t, previous)
+
+	devPlan := orchestrator.PlanArtifact{Hash: "a", Adds: 1}
+	prodPlan := orchestrator.PlanArtifact{Hash: "b", Destroys: 1}
+	assert.NoError(t, svc.StorePlanArtifact(1, "dev", devPlan))
+	assert.NoError(t, svc.StorePlanArtifact(1, "prod", prodPlan))
+	devReplan := orchestrator.PlanArtifact{Hash: "c", Adds: 3}
+	assert.NoError(t, svc.StorePlanArtifact(1, "dev", devReplan))
+
+	previous, err = svc.LoadPreviousPlan(1, "dev")
+	assert.NoError(t, err)
+	assert.Equal(t, &devReplan, previous)
+	previous, err = svc.LoadPreviousPlan(1, "prod")
+	assert.NoError(t, err)
+	assert.Equal(t, &prodPlan, previous)
+	assert.Equal(t, 2, strings.Count(*body, "digger-plan-artifact:"))
+}
+
+func TestMergePullRequestWithCoAuthors(t *testing.T) {
+	svc, mux := setupTestService(t)
+	svc.SquashCoAuthors = true
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 1, "title": "Add bucket", "user": {"login": "alice"}, "head": {"sha": "abc"}}`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1/commits", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"author": {"login": "alice"}, "commit": {"author": {"name": "Alice", "email": "alice@example.com"}, "message": "Add bucket\n\nCo-authored-by: Carol <carol@example.com>"}},
+			{"author": {"login": "bob"}, "commit": {"author": {"name": "Bob", "email": "bob@example.com"}, "message": "Fix tags"}},
+			{"author": {"login": "bob"}, "commit": {"author": {"name": "Bob", "email": "bob@example.com"}, "message": "Fix name"}}
+		]`)
+	})
+	var message string
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1/merge", func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			CommitMessage string `json:"commit_message"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		message = request.CommitMessage
+		fmt.Fprint(w, `{"merged": true}`)
+	})
+
+	err := svc.MergePullRequest(1, "", "Applied by digger\n\nCo-authored-by: Bob <bob@example.com>")
+	assert.NoError(t, err)
+	assert.Equal(t, "Applied by digger\n\nCo-authored-by: Bob <bob@example.com>\nCo-authored-by: Carol <carol@example.com>", message)
+
+	err = svc.MergePullRequest(1, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "Co-authored-by: Carol <carol@example.com>\nCo-authored-by: Bob <bob@example.com>", message)
+}
+
+func TestConvertGithubWorkflowDispatchEventToJobs(t *testing.T) {
+	fullName := "diggerhq/demo"
+	login := "user"
+	event := func(inputs string) *github.WorkflowDispatchEvent {
+		return &github.WorkflowDispatchEvent{
+			Inputs: json.RawMessage(inputs),
+			Repo:   &github.Repository{FullName: &fullName},
+			Sender: &github.User{Login: &login},
+		}
+	}
+	impactedProjects := []configuration.Project{{Name: "app", Dir: "app", Workflow: "default", Workspace: "default"}}
+	workflows := map[string]configuration.Workflow{
+		"default": {
+			Plan:  &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "plan"}}},
+			Apply: &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "apply"}}},
+		},
+	}
+	environments := map[string]Environment{
+		"staging":    {Workspace: "staging", VarFile: "staging.tfvars"},
+		"production": {Workspace: "production"},
+	}
+
+	jobs, err := ConvertGithubWorkflowDispatchEventToJobs(event(`{}`), impactedProjects, workflows, environments)
+	assert.NoError(t, err)
+	if assert.Len(t, jobs, 1) {
+		assert.Equal(t, []string{"digger plan"}, jobs[0].Commands)
+		assert.Equal(t, "default", jobs[0].ProjectWorkspace)
+		assert.Empty(t, jobs[0].CommandArgs)
+		assert.Equal(t, "workflow_dispatch", jobs[0].EventName)
+		assert.Nil(t, jobs[0].PullRequestNumber)
+	}
+
+	jobs, _, err = EventConverter{Environments: environments}.ConvertToJobs(event(`{"command": "digger apply", "environment": "staging"}`), impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	if assert.Len(t, jobs, 1) {
+		assert.Equal(t, []string{"digger apply"}, jobs[0].Commands)
+		assert.Equal(t, "staging", jobs[0].ProjectWorkspace)
+		assert.Equal(t, []string{"-var-file=staging.tfvars"}, jobs[0].CommandArgs)
+	}
+
+	_, err = ConvertGithubWorkflowDispatchEventToJobs(event(`{"environment": "qa"}`), impactedProjects, workflows, environments)
+	assert.ErrorIs(t, err, ErrUnknownEnvironment)
+	assert.ErrorContains(t, err, "expected one of: production, staging")
+
+	_, err = ConvertGithubWorkflowDispatchEventToJobs(event(`{"command": "digger destroy"}`), impactedProjects, workflows, environments)
+	assert.ErrorContains(t, err, "unsupported command")
+}
+
+func TestHasMergeConflicts(t *testing.T) {
+	interval := mergeabilityPollInterval
+	mergeabilityPollInterval = time.Millisecond
+	t.Cleanup(func() { mergeabilityPollInterval = interval })
+
+	svc, mux := setupTestService(t)
+	responses := map[string][]string{
+		"1": {`{"mergeable": true, "mergeable_state": "clean"}`},
+		"2": {`{"mergeable": false, "mergeable_state": "dirty"}`},
+		"3": {`{"mergeable": true, "mergeable_state": "blocked"}`},
+		"4": {`{"mergeable": null, "mergeable_state": "unknown"}`, `{"mergeable": false, "mergeable_state": "dirty"}`},
+		"5": {`{"mergeable": null, "mergeable_state": "unknown"}`},
+	}
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/", func(w http.ResponseWriter, r *http.Request) {
+		number := strings.TrimPrefix(r.URL.Path, "/repos/diggerhq/demo/pulls/")
+		fmt.Fprint(w, responses[number][0])
+		if len(responses[number]) > 1 {
+			responses[number] = responses[number][1:]
+		}
+	})
+
+	for prNumber, expected := range map[int]bool{1: false, 2: true, 3: false, 4: true} {
+		conflicts, err := svc.HasMergeConflicts(prNumber)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, conflicts, prNumber)
+	}
+
+	_, err := svc.HasMergeConflicts(5)
+	assert.ErrorIs(t, err, ErrMergeabilityUnknown)
+}
+
+func TestPutFileContent(t *testing.T) {
+	svc, mux := setupTestService(t)
+	files := map[string]string{"plans/dev.txt": "blob1"}
+	var written []map[string]interface{}
+	mux.HandleFunc("/repos/diggerhq/demo/contents/", func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/repos/diggerhq/demo/contents/")
+		if r.Method == http.MethodGet {
+			assert.Equal(t, "digger-plans", r.URL.Query().Get("ref"))
+			sha, ok := files[path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"message": "Not Found"}`)
+				return
+			}
+			fmt.Fprintf(w, `{"type": "file", "path": %q, "sha": %q}`, path, sha)
+			return
+		}
+		assert.Equal(t, http.MethodPut, r.Method)
+		var request map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		written = append(written, request)
+		fmt.Fprint(w, `{"commit": {"sha": "commit1"}}`)
+	})
+
+	sha, err := svc.PutFileContent("digger-plans", "plans/dev.txt", "plan", "Update dev plan")
+	assert.NoError(t, err)
+	assert.Equal(t, "commit1", sha)
+	sha, err = svc.PutFileContent("digger-plans", "plans/prod.txt", "plan", "Add prod plan")
+	assert.NoError(t, err)
+	assert.Equal(t, "commit1", sha)
+
+	if assert.Len(t, written, 2) {
+		assert.Equal(t, "blob1", written[0]["sha"])
+		assert.Equal(t, "digger-plans", written[0]["branch"])
+		assert.Equal(t, "cGxhbg==", written[0]["content"])
+		assert.NotContains(t, written[1], "sha")
+	}
+}
+
+func TestGetRulesForBranch(t *testing.T) {
+	svc, mux := setupTestService(t)
+	mux.HandleFunc("/repos/diggerhq/demo/rules/branches/main", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"type": "pull_request", "parameters": {"required_approving_review_count": 2}},
+			{"type": "required_status_checks", "parameters": {"required_status_checks": [{"context": "digger/plan/dev"}]}},
+			{"type": "deletion"}
+		]`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/branches/main/protection", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message": "Resource not accessible by integration"}`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/rules/branches/legacy", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/branches/legacy/protection", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"required_pull_request_reviews": {"required_approving_review_count": 1}, "required_status_checks": {"strict": true, "contexts": ["ci/build"], "checks": [{"context": "ci/build"}, {"context": "ci/lint"}]}}`)
+	})
+
+	rules, err := svc.GetRulesForBranch("main")
+	assert.NoError(t, err)
+	assert.Equal(t, BranchRules{RequiredApprovingReviewCount: 2, RequiredStatusChecks: []string{"digger/plan/dev"}}, rules)
+
+	rules, err = svc.GetRulesForBranch("legacy")
+	assert.NoError(t, err)
+	assert.Equal(t, BranchRules{RequiredApprovingReviewCount: 1, RequiredStatusChecks: []string{"ci/build", "ci/lint"}}, rules)
+}
+
+func TestGetCommitMessage(t *testing.T) {
+	svc, mux := setupTestService(t)
+	mux.HandleFunc("/repos/diggerhq/demo/git/commits/abc", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"sha": "abc", "message": "Update docs [skip digger]"}`)
+	})
+
+	message, err := svc.GetCommitMessage("abc")
+	assert.NoError(t, err)
+	assert.Equal(t, "Update docs [skip digger]", message)
+}
+
+func TestEventConverterSkipToken(t *testing.T) {
+	fullName := "diggerhq/demo"
+	defaultBranch := "main"
+	login := "user"
+	impactedProjects := []configuration.Project{{Name: "dev", Dir: "dev", Workflow: "default"}}
+	workflows := map[string]configuration.Workflow{
+		"default": {
+			Configuration: &configuration.WorkflowConfiguration{
+				OnPullRequestPushed: []string{"digger plan"},
+				OnCommitToDefault:   []string{"digger apply"},
+			},
+		},
+	}
+	push := func(ref string, message string) *github.PushEvent {
+		return &github.PushEvent{
+			Ref:        &ref,
+			HeadCommit: &github.HeadCommit{Message: &message},
+			Repo:       &github.PushEventRepository{FullName: &fullName, DefaultBranch: &defaultBranch},
+			Sender:     &github.User{Login: &login},
+		}
+	}
+
+	jobs, _, err := EventConverter{}.ConvertToJobs(push("refs/heads/main", "Add network module"), impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, []string{"digger apply"}, jobs[0].Commands)
+	assert.Equal(t, "push", jobs[0].EventName)
+
+	jobs, _, err = EventConverter{}.ConvertToJobs(push("refs/heads/main", "Update docs [skip digger]"), impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	assert.Empty(t, jobs)
+
+	jobs, _, err = EventConverter{}.ConvertToJobs(push("refs/heads/feature", "Add network module"), impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	assert.Empty(t, jobs)
+
+	jobs, _, err = EventConverter{SkipToken: "[no-plan]"}.ConvertToJobs(push("refs/heads/main", "Update docs [skip digger]"), impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+
+	prNumber := 1
+	action := "synchronize"
+	headSHA := "abc"
+	payload := &github.PullRequestEvent{
+		Action:      &action,
+		PullRequest: &github.PullRequest{Number: &prNumber, Head: &github.PullRequestBranch{SHA: &headSHA}},
+		Repo:        &github.Repository{FullName: &fullName},
+		Sender:      &github.User{Login: &login},
+	}
+	message := "Add network module"
+	converter := EventConverter{CommitMessage: func(sha string) (string, error) {
+		assert.Equal(t, "abc", sha)
+		return message, nil
+	}}
+
+	jobs, _, err = converter.ConvertToJobs(payload, impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+
+	message = "Update docs\n\n[skip digger]"
+	jobs, _, err = converter.ConvertToJobs(payload, impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	assert.Empty(t, jobs)
+
+	jobs, _, err = EventConverter{}.ConvertToJobs(payload, impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+}
+
+func TestConvertGithubPullRequestTargetEventToJobs(t *testing.T) {
+	prNumber := 1
+	action := "closed"
+	merged := true
+	baseRef := "main"
+	fullName := "diggerhq/demo"
+	forkName := "someone/demo"
+	login := "someone"
+	impactedProjects := []configuration.Project{{Name: "dev", Dir: "dev", Workflow: "default"}}
+	workflows := map[string]configuration.Workflow{
+		"default": {
+			Configuration: &configuration.WorkflowConfiguration{
+				OnPullRequestPushed: []string{"digger plan"},
+				OnCommitToDefault:   []string{"digger plan", "digger apply"},
+			},
+		},
+	}
+	event := func(headRepo string, association string) *github.PullRequestTargetEvent {
+		return &github.PullRequestTargetEvent{
+			Action: &action,
+			PullRequest: &github.PullRequest{
+				Number:            &prNumber,
+				Merged:            &merged,
+				AuthorAssociation: &association,
+				Head:              &github.PullRequestBranch{Repo: &github.Repository{FullName: &headRepo}},
+				Base:              &github.PullRequestBranch{Ref: &baseRef, Repo: &github.Repository{FullName: &fullName}},
+			},
+			Repo:   &github.Repository{FullName: &fullName, DefaultBranch: &baseRef},
+			Sender: &github.User{Login: &login},
+		}
+	}
+
+	jobs, _, err := ConvertGithubPullRequestTargetEventToJobs(event(forkName, "CONTRIBUTOR"), impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, []string{"digger plan"}, jobs[0].Commands)
+	assert.Equal(t, "pull_request_target", jobs[0].EventName)
+	assert.Equal(t, []string{"digger plan", "digger apply"}, workflows["default"].Configuration.OnCommitToDefault)
+
+	jobs, _, err = ConvertGithubPullRequestTargetEventToJobs(event(forkName, "MEMBER"), impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, []string{"digger plan", "digger apply"}, jobs[0].Commands)
+
+	jobs, _, err = EventConverter{}.ConvertToJobs(event(fullName, "NONE"), impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, []string{"digger plan", "digger apply"}, jobs[0].Commands)
+
+	workflows["default"].Configuration.OnCommitToDefault = []string{"digger apply"}
+	jobs, _, err = EventConverter{}.ConvertToJobs(*event(forkName, "FIRST_TIME_CONTRIBUTOR"), impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	assert.Empty(t, jobs)
+
+	action = "opened"
+	jobs, _, err = EventConverter{}.ConvertToJobs(event(forkName, "FIRST_TIME_CONTRIBUTOR"), impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, []string{"digger plan"}, jobs[0].Commands)
+}
+
+func TestCommandAccess(t *testing.T) {
+	assert.NoError(t, CommandAccess{}.Check("anyone"))
+
+	access := CommandAccess{Allow: []string{"alice", "Bob"}}
+	assert.NoError(t, access.Check("alice"))
+	assert.NoError(t, access.Check("bob"))
+	err := access.Check("mallory")
+	assert.ErrorIs(t, err, ErrCommandDenied)
+	assert.ErrorContains(t, err, "user mallory is not allowed to run digger commands, they aren't in the allowlist")
+
+	access = CommandAccess{Deny: []string{"mallory"}}
+	assert.NoError(t, access.Check("alice"))
+	assert.ErrorIs(t, access.Check("Mallory"), ErrCommandDenied)
+
+	// the denylist wins over the allowlist
+	access = CommandAccess{Allow: []string{"alice", "mallory"}, Deny: []string{"mallory"}}
+	assert.NoError(t, access.Check("alice"))
+	err = access.Check("mallory")
+	assert.ErrorIs(t, err, ErrCommandDenied)
+	assert.ErrorContains(t, err, "they are in the denylist")
+}
+
+func TestEventConverterCommandAccess(t *testing.T) {
+	issueNumber := 1
+	fullName := "diggerhq/demo"
+	event := func(login string, body string) *github.IssueCommentEvent {
+		return &github.IssueCommentEvent{
+			Comment: &github.IssueComment{Body: &body},
+			Issue:   &github.Issue{Number: &issueNumber},
+			Repo:    &github.Repository{FullName: &fullName},
+			Sender:  &github.User{Login: &login},
+		}
+	}
+	impactedProjects := []configuration.Project{{Name: "dev", Dir: "dev", Workflow: "default"}}
+	workflows := map[string]configuration.Workflow{"default": {}}
+	converter := EventConverter{CommandAccess: CommandAccess{Allow: []string{"alice"}, Deny: []string{"mallory"}}}
+
+	jobs, _, err := converter.ConvertToJobs(event("alice", "digger apply"), impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+
+	_, _, err = converter.ConvertToJobs(event("bob", "digger apply"), impactedProjects, nil, workflows)
+	assert.ErrorIs(t, err, ErrCommandDenied)
+
+	_, _, err = converter.ConvertToJobs(event("mallory", "digger plan"), impactedProjects, nil, workflows)
+	assert.ErrorIs(t, err, ErrCommandDenied)
+
+	// comments that aren't commands are ignored whoever wrote them
+	jobs, _, err = converter.ConvertToJobs(event("mallory", "looks good"), impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	assert.Empty(t, jobs)
+}
+
+func TestPullRequestReviewCommentEvent(t *testing.T) {
+	svc, mux := setupTestService(t)
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"filename": "dev/main.tf"}, {"filename": "prod/main.tf"}, {"filename": "README.md"}]`)
+	})
+	prNumber := 1
+	action := "created"
+	fullName := "diggerhq/demo"
+	login := "user"
+	event := func(path string, body string) *github.PullRequestReviewCommentEvent {
+		return &github.PullRequestReviewCommentEvent{
+			Action:      &action,
+			Comment:     &github.PullRequestComment{Path: &path, Body: &body},
+			PullRequest: &github.PullRequest{Number: &prNumber},
+			Repo:        &github.Repository{FullName: &fullName},
+			Sender:      &github.User{Login: &login},
+		}
+	}
+	diggerConfig := &configuration.DiggerConfig{Projects: []configuration.Project{
+		{Name: "dev", Dir: "dev", Workflow: "default"},
+		{Name: "prod", Dir: "prod", Workflow: "default"},
+	}}
+	workflows := map[string]configuration.Workflow{"default": {}}
+
+	impactedProjects, requestedProject, number, err := ProcessGitHubEvent(event("prod/main.tf", "digger plan"), diggerConfig, &svc, ProcessEventOptions{})
+	assert.NoError(t, err)
+	assert.Nil(t, requestedProject)
+	assert.Equal(t, 1, number)
+	assert.Len(t, impactedProjects, 1)
+	assert.Equal(t, "prod", impactedProjects[0].Name)
+
+	jobs, _, err := EventConverter{}.ConvertToJobs(event("prod/main.tf", "digger plan"), impactedProjects, nil, workflows)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, "prod", jobs[0].ProjectName)
+	assert.Equal(t, []string{"digger plan"}, jobs[0].Commands)
+	assert.Equal(t, "pull_request_review_comment", jobs[0].EventName)
+	assert.Equal(t, 1, *jobs[0].PullRequestNumber)
+
+	_, _, _, err = ProcessGitHubEvent(event("README.md", "digger plan"), diggerConfig, &svc, ProcessEventOptions{})
+	assert.ErrorIs(t, err, ErrFileNotInProject)
+
+	jobs, _, err = EventConverter{CommandAccess: CommandAccess{Deny: []string{"user"}}}.ConvertToJobs(event("prod/main.tf", "digger plan"), impactedProjects, nil, workflows)
+	assert.ErrorIs(t, err, ErrCommandDenied)
+	assert.Empty(t, jobs)
+
+	// other comments on files don't run anything
+	impactedProjects, _, _, err = ProcessGitHubEvent(event("README.md", "typo here"), diggerConfig, &svc, ProcessEventOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, impactedProjects)
+	jobs, _, err = EventConverter{}.ConvertToJobs(event("dev/main.tf", "digger apply"), diggerConfig.Projects, nil, workflows)
+	assert.NoError(t, err)
+	assert.Empty(t, jobs)
+}
+
+func TestGetWorkflowRunURL(t *testing.T) {
+	svc, mux := setupTestService(t)
+	mux.HandleFunc("/repos/diggerhq/demo/actions/runs/42", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 42, "html_url": "https://github.com/diggerhq/demo/actions/runs/42"}`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/actions/runs/43", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message": "Resource not accessible by integration"}`)
+	})
+
+	url, err := svc.GetWorkflowRunURL(42)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://github.com/diggerhq/demo/actions/runs/42", url)
+
+	_, err = svc.GetWorkflowRunURL(43)
+	assert.ErrorIs(t, err, ErrInsufficientPermissions)
+	assert.ErrorContains(t, err, "actions:read")
+}
+
+func TestReplanAllOpenPRs(t *testing.T) {
+	svc, mux := setupTestService(t)
+	svc.ReplanConcurrency = 1
+	mux.HandleFunc("/repos/diggerhq/demo/pulls", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "open", r.URL.Query().Get("state"))
+		fmt.Fprint(w, `[{"number": 2, "user": {"login": "bob"}}, {"number": 1, "user": {"login": "alice"}}, {"number": 3, "user": {"login": "carol"}}]`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"filename": "dev/main.tf"}]`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/2/files", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"filename": "dev/main.tf"}, {"filename": "prod/main.tf"}]`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/3/files", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"filename": "README.md"}]`)
+	})
+	cfg := &configuration.DiggerConfig{
+		Projects: []configuration.Project{
+			{Name: "dev", Dir: "dev", Workflow: "default"},
+			{Name: "prod", Dir: "prod", Workflow: "default"},
+		},
+		Workflows: map[string]configuration.Workflow{
+			"default": {Configuration: &configuration.WorkflowConfiguration{OnPullRequestPushed: []string{"digger plan"}}},
+		},
+	}
+
+	jobs, err := svc.ReplanAllOpenPRs(cfg)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 3)
+	type planned struct {
+		prNumber    int
+		project     string
+		requestedBy string
+	}
+	var plans []planned
+	for _, job := range jobs {
+		plans = append(plans, planned{*job.PullRequestNumber, job.ProjectName, job.RequestedBy})
+		assert.Equal(t, []string{"digger plan"}, job.Commands)
+		assert.Equal(t, "diggerhq/demo", job.Namespace)
+	}
+	assert.Equal(t, []planned{{2, "dev", "bob"}, {2, "prod", "bob"}, {1, "dev", "alice"}}, plans)
+}
+
+func TestReplanAllOpenPRsReturnsJobsOfOtherPRsOnError(t *testing.T) {
+	svc, mux := setupTestService(t)
+	mux.HandleFunc("/repos/diggerhq/demo/pulls", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"number": 1}, {"number": 2}]`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"filename": "dev/main.tf"}]`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/2/files", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	cfg := &configuration.DiggerConfig{
+		Projects: []configuration.Project{{Name: "dev", Dir: "dev", Workflow: "default"}},
+		Workflows: map[string]configuration.Workflow{
+			"default": {Configuration: &configuration.WorkflowConfiguration{OnPullRequestPushed: []string{"digger plan"}}},
+		},
+	}
+
+	jobs, err := svc.ReplanAllOpenPRs(cfg)
+	assert.ErrorContains(t, err, "error replanning PR #2")
+	assert.NotContains(t, err.Error(), "PR #1")
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, 1, *jobs[0].PullRequestNumber)
+	assert.Equal(t, "dev", jobs[0].ProjectName)
+}
+
+func TestProcessGitHubEventPush(t *testing.T) {
+	ref := "refs/heads/main"
+	event := &github.PushEvent{
+		Ref: &ref,
+		Commits: []*github.HeadCommit{
+			{Added: []string{"dev/vpc.tf"}, Modified: []string{"README.md"}},
+			{Modified: []string{"dev/vpc.tf"}, Removed: []string{"prod/old.tf"}},
+		},
+	}
+	assert.Equal(t, []string{"dev/vpc.tf", "README.md", "prod/old.tf"}, PushChangedFiles(event))
+
+	diggerConfig := &configuration.DiggerConfig{Projects: []configuration.Project{
+		{Name: "dev", Dir: "dev"},
+		{Name: "prod", Dir: "prod"},
+		{Name: "staging", Dir: "staging"},
+	}}
+	impactedProjects, requestedProject, prNumber, err := ProcessGitHubEvent(event, diggerConfig, &GithubService{}, ProcessEventOptions{})
+	assert.NoError(t, err)
+	assert.Nil(t, requestedProject)
+	assert.Equal(t, 0, prNumber)
+	assert.Len(t, impactedProjects, 2)
+	assert.Equal(t, "dev", impactedProjects[0].Name)
+	assert.Equal(t, "prod", impactedProjects[1].Name)
+
+	_, _, _, err = ProcessGitHubEvent(*event, diggerConfig, &GithubService{}, ProcessEventOptions{MaxChangedFiles: 2})
+	assert.ErrorIs(t, err, ErrTooManyChangedFiles)
+}
+
+func TestCheckPermissionsIsAppliedToPullRequestLookups(t *testing.T) {
+	svc, mux := setupTestService(t)
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message": "Resource not accessible by integration"}`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message": "Resource not accessible by integration"}`)
+	})
+
+	_, err := svc.GetPullRequestBody(1)
+	assert.ErrorIs(t, err, ErrInsufficientPermissions)
+	_, err = svc.GetAuthorAssociation(1)
+	assert.ErrorIs(t, err, ErrInsufficientPermissions)
+	_, err = svc.GetMergedPullRequestChangedFiles(1)
+	assert.ErrorIs(t, err, ErrInsufficientPermissions)
+	_, err = svc.DeleteCommentsByMarker(1, "<!-- digger -->")
+	assert.ErrorIs(t, err, ErrInsufficientPermissions)
+
+	// errors wrapped twice on their way up only name the permission once
+	err = svc.SetStatus(1, "pending", "digger/plan")
+	assert.ErrorIs(t, err, ErrInsufficientPermissions)
+	assert.Equal(t, 1, strings.Count(err.Error(), "pull_requests:read"))
+}
+
+func TestIsBranchUpToDate(t *testing.T) {
+	svc, mux := setupTestService(t)
+	statuses := map[string]string{"1": "ahead", "2": "identical", "3": "behind", "4": "diverged"}
+	for number := range statuses {
+		number := number
+		mux.HandleFunc("/repos/diggerhq/demo/pulls/"+number, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"number": %v, "base": {"ref": "main"}, "head": {"sha": "head%v"}}`, number, number)
+		})
+		mux.HandleFunc("/repos/diggerhq/demo/compare/main...head"+number, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"status": %q}`, statuses[number])
+		})
+	}
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/5", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 5, "base": {"ref": "main"}, "head": {"sha": "head5"}}`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/compare/main...head5", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message": "Resource not accessible by integration"}`)
+	})
+
+	upToDate, err := svc.IsBranchUpToDate(1)
+	assert.NoError(t, err)
+	assert.True(t, upToDate)
+
+	upToDate, err = svc.IsBranchUpToDate(2)
+	assert.NoError(t, err)
+	assert.True(t, upToDate)
+
+	upToDate, err = svc.IsBranchUpToDate(3)
+	assert.NoError(t, err)
+	assert.False(t, upToDate)
+
+	upToDate, err = svc.IsBranchUpToDate(4)
+	assert.NoError(t, err)
+	assert.False(t, upToDate)
+
+	_, err = svc.IsBranchUpToDate(5)
+	assert.ErrorIs(t, err, ErrInsufficientPermissions)
+
+	_, err = svc.IsBranchUpToDate(6)
+	assert.Error(t, err)
+}
+
+func TestUpdatePullRequestBranch(t *testing.T) {
+	svc, mux := setupTestService(t)
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1/update-branch", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, `{"message": "Updating pull request branch.", "url": "https://github.com/diggerhq/demo/pull/1"}`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/2/update-branch", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprint(w, `{"message": "merge conflict between base and head"}`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/3/update-branch", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprint(w, `{"message": "expected head sha didn't match current head ref."}`)
+	})
+
+	// the update is scheduled asynchronously
+	assert.NoError(t, svc.UpdatePullRequestBranch(1))
+
+	err := svc.UpdatePullRequestBranch(2)
+	assert.ErrorIs(t, err, ErrUpdateBranchMergeConflict)
+	assert.ErrorContains(t, err, "merge conflict between base and head")
+
+	err = svc.UpdatePullRequestBranch(3)
+	assert.ErrorContains(t, err, "expected head sha didn't match current head ref")
+	assert.NotErrorIs(t, err, ErrUpdateBranchMergeConflict)
+}
+
+func TestGetMergeBaseSHA(t *testing.T) {
+	svc, mux := setupTestService(t)
+	mux.HandleFunc("/repos/diggerhq/demo/compare/main...feature", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status": "diverged", "merge_base_commit": {"sha": "base1"}}`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/compare/main...orphan", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status": "diverged"}`)
+	})
+	mux.HandleFunc("/repos/diggerhq/demo/compare/main...missing", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "No common ancestor between main and missing."}`)
+	})
+
+	sha, err := svc.GetMergeBaseSHA("main", "feature")
+	assert.NoError(t, err)
+	assert.Equal(t, "base1", sha)
+
+	sha, err = svc.GetMergeBaseSHA("main", "orphan")
+	assert.ErrorContains(t, err, "no merge base between main and orphan")
+	assert.Empty(t, sha)
+
+	sha, err = svc.GetMergeBaseSHA("main", "missing")
+	assert.ErrorContains(t, err, "they may be unrelated")
+	assert.Empty(t, sha)
+}
+
+func TestCommitStatusReporter(t *testing.T) {
+	svc, mux := setupTestService(t)
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 1, "head": {"sha": "head"}, "base": {"sha": "base"}}`)
+	})
+	var sent github.RepoStatus
+	mux.HandleFunc("/repos/diggerhq/demo/statuses/head", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&sent))
+		fmt.Fprint(w, `{"id": 1}`)
+	})
+
+	expectedStates := map[orchestrator.JobStatus]string{
+		orchestrator.PlanPending:    "pending",
+		orchestrator.PlanSucceeded:  "success",
+		orchestrator.PlanFailed:     "failure",
+		orchestrator.ApplyPending:   "pending",
+		orchestrator.ApplySucceeded: "success",
+		orchestrator.ApplyFailed:    "failure",
+	}
+	for status, state := range expectedStates {
+		sent = github.RepoStatus{}
+		assert.NoError(t, svc.SetJobStatus(1, status, "digger/dev"))
+		assert.Equal(t, state, sent.GetState(), status.Description())
+		assert.Equal(t, "digger/dev", sent.GetContext())
+		assert.Equal(t, status.Description(), sent.GetDescription())
+	}
+}
+
+func TestCheckRunReporter(t *testing.T) {
+	svc, mux := setupTestService(t)
+	svc.StatusReporter = &CheckRunReporter{Client: svc.Client, Owner: svc.Owner, RepoName: svc.RepoName}
+	mux.HandleFunc("/repos/diggerhq/demo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 1, "head": {"sha": "head"}, "base": {"sha": "base"}}`)
+	})
+	// a check run already exists for prod and is updated, one is created for dev
+	mux.HandleFunc("/repos/diggerhq/demo/commits/head/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("check_name") == "digger/prod" {
+			fmt.Fprint(w, `{"total_count": 1, "check_runs": [{"id": 5, "name": "digger/prod"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"total_count": 0, "check_runs": []}`)
+	})
+	var sent map[string]interface{}
+	var method string
+	record := func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		sent = nil
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&sent))
+		fmt.Fprint(w, `{"id": 5}`)
+	}
+	mux.HandleFunc("/repos/diggerhq/demo/check-runs", record)
+	mux.HandleFunc("/repos/diggerhq/demo/check-runs/5", record)
+
+	testCases := []struct {
+		status     orchestrator.JobStatus
+		checkState string
+		conclusion interface{}
+	}{
+		{orchestrator.PlanPending, "in_progress", nil},
+		{orchestrator.PlanSucceeded, "completed", "success"},
+		{orchestrator.PlanFailed, "completed", "failure"},
+		{orchestrator.ApplyPending, "in_progress", nil},
+		{orchestrator.ApplySucceeded, "completed", "success"},
+		{orchestrator.ApplyFailed, "completed", "failure"},
+	}
+	for _, testCase := range testCases {
+		assert.NoError(t, svc.SetJobStatus(1, testCase.status, "digger/dev"))
+		assert.Equal(t, http.MethodPost, method)
+		assert.Equal(t, "head", sent["head_sha"])
+		assert.Equal(t, testCase.checkState, sent["status"], testCase.status.Description())
+		assert.Equal(t, testCase.conclusion, sent["conclusion"], testCase.status.Description())
+
+		assert.NoError(t, svc.SetJobStatus(1, testCase.status, "digger/prod"))
+		assert.Equal(t, http.MethodPatch, method)
+		assert.Equal(t, testCase.checkState, sent["status"], testCase.status.Description())
+		assert.Equal(t, testCase.conclusion, sent["conclusion"], testCase.status.Description())
+	}
+
+	err := (&CheckRunReporter{Client: svc.Client, Owner: svc.Owner, RepoName: svc.RepoName}).ReportStatus(context.Background(), "head", "queued", "digger/dev", "")
+	assert.ErrorContains(t, err, "unsupported status: queued")
+}
@@ -0,0 +1,111 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	orchestrator "github.com/diggerhq/lib-orchestrator"
+)
+
+type graphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// graphQL runs a GraphQL query through the REST client so that authentication and transport settings are shared,
+// result is unmarshalled from the "data" field of the response
+func (svc *GithubService) graphQL(query string, variables map[string]interface{}, result interface{}) error {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	// GitHub Enterprise serves GraphQL at /api/graphql next to the /api/v3/ REST base URL
+	endpoint := "graphql"
+	if strings.HasSuffix(svc.Client.BaseURL.Path, "/api/v3/") {
+		endpoint = "../graphql"
+	}
+
+	req, err := svc.Client.NewRequest("POST", endpoint, graphQLRequest{Query: query, Variables: variables})
+	if err != nil {
+		return fmt.Errorf("error creating graphql request: %v", err)
+	}
+
+	var response graphQLResponse
+	_, err = svc.Client.Do(ctx, req, &response)
+	if err != nil {
+		return fmt.Errorf("error running graphql query: %v", err)
+	}
+	if len(response.Errors) > 0 {
+		messages := make([]string, len(response.Errors))
+		for i, graphQLErr := range response.Errors {
+			messages[i] = graphQLErr.Message
+		}
+		return fmt.Errorf("graphql query failed: %v", strings.Join(messages, "; "))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(response.Data, result)
+}
+
+const pullRequestFilesQuery = `query($owner: String!, $repo: String!, $number: Int!, $cursor: String) {
+  repository(owner: $owner, name: $repo) {
+    pullRequest(number: $number) {
+      files(first: 100, after: $cursor) {
+        nodes {
+          path
+        }
+        pageInfo {
+          hasNextPage
+          endCursor
+        }
+      }
+    }
+  }
+}`
+
+type pullRequestFilesResult struct {
+	Repository struct {
+		PullRequest struct {
+			Files struct {
+				Nodes []struct {
+					Path string `json:"path"`
+				} `json:"nodes"`
+				PageInfo struct {
+					HasNextPage bool   `json:"hasNextPage"`
+					EndCursor   string `json:"endCursor"`
+				} `json:"pageInfo"`
+			} `json:"files"`
+		} `json:"pullRequest"`
+	} `json:"repository"`
+}
+
+func (svc *GithubService) getChangedFilesGraphQL(prNumber int) ([]string, error) {
+	var fileNames []string
+	variables := map[string]interface{}{
+		"owner":  svc.Owner,
+		"repo":   svc.RepoName,
+		"number": prNumber,
+	}
+	for {
+		var result pullRequestFilesResult
+		err := svc.graphQL(pullRequestFilesQuery, variables, &result)
+		if err != nil {
+			return nil, err
+		}
+		files := result.Repository.PullRequest.Files
+		for _, file := range files.Nodes {
+			fileNames = append(fileNames, orchestrator.NormalizePath(file.Path))
+		}
+		if !files.PageInfo.HasNextPage {
+			return fileNames, nil
+		}
+		variables["cursor"] = files.PageInfo.EndCursor
+	}
+}
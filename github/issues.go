@@ -0,0 +1,90 @@
+package github
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// driftIssueMarker identifies the issue maintained by CreateOrUpdateDriftIssue
+const driftIssueMarker = "<!-- digger-drift-issue -->"
+
+// PublishIssueComment comments on an issue, e.g. to report drift where there is no pull request, and returns the comment ID
+func (svc *GithubService) PublishIssueComment(issueNumber int, body string) (int64, error) {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	comment, _, err := svc.Client.Issues.CreateComment(ctx, svc.Owner, svc.RepoName, issueNumber, &github.IssueComment{Body: &body})
+	if err != nil {
+		return 0, fmt.Errorf("error commenting on issue %d: %w", issueNumber, checkPermissions(err))
+	}
+	return comment.GetID(), nil
+}
+
+// CreateCommitComment comments on a whole commit, e.g. to attach drift or push results where there is no pull
+// request, and returns the comment ID
+func (svc *GithubService) CreateCommitComment(sha string, body string) (int64, error) {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	// path and position are left unset, they would attach the comment to a line of the diff
+	comment, _, err := svc.Client.Repositories.CreateComment(ctx, svc.Owner, svc.RepoName, sha, &github.RepositoryComment{Body: &body})
+	if err != nil {
+		return 0, fmt.Errorf("error commenting on commit %v: %w", sha, checkPermissions(err))
+	}
+	return comment.GetID(), nil
+}
+
+// findOpenIssueByMarker returns the open issue whose body contains marker, or nil if there is none
+func (svc *GithubService) findOpenIssueByMarker(marker string) (*github.Issue, error) {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	opts := &github.IssueListByRepoOptions{State: "open", ListOptions: github.ListOptions{PerPage: svc.perPage()}}
+	for {
+		issues, resp, err := svc.Client.Issues.ListByRepo(ctx, svc.Owner, svc.RepoName, opts)
+		if err != nil {
+			return nil, fmt.Errorf("error listing issues: %w", checkPermissions(err))
+		}
+		for _, issue := range issues {
+			// pull requests are listed as issues too
+			if !issue.IsPullRequest() && strings.Contains(issue.GetBody(), marker) {
+				return issue, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return nil, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// CreateOrUpdateDriftIssue keeps a single open issue reporting drift, the existing one is updated with title and body
+// instead of opening a new issue on every drift run. Returns the issue number.
+func (svc *GithubService) CreateOrUpdateDriftIssue(title string, body string) (int, error) {
+	body = body + "\n\n" + driftIssueMarker
+	existing, err := svc.findOpenIssueByMarker(driftIssueMarker)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	if existing != nil {
+		issue, _, err := svc.Client.Issues.Edit(ctx, svc.Owner, svc.RepoName, existing.GetNumber(), &github.IssueRequest{
+			Title: &title,
+			Body:  &body,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("error updating drift issue %d: %w", existing.GetNumber(), checkPermissions(err))
+		}
+		return issue.GetNumber(), nil
+	}
+
+	issue, _, err := svc.Client.Issues.Create(ctx, svc.Owner, svc.RepoName, &github.IssueRequest{
+		Title: &title,
+		Body:  &body,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error creating drift issue: %w", checkPermissions(err))
+	}
+	return issue.GetNumber(), nil
+}
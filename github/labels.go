@@ -0,0 +1,129 @@
+package github
+
+import (
+	"fmt"
+	"log"
+
+	configuration "github.com/diggerhq/lib-digger-config"
+	orchestrator "github.com/diggerhq/lib-orchestrator"
+	"github.com/google/go-github/v55/github"
+)
+
+// LabelTriggers configures the pull request labels that trigger jobs when they are added
+type LabelTriggers struct {
+	// PlanLabel, e.g. "digger:plan", runs the commands configured for pushes to the pull request
+	PlanLabel string
+	// ApplyLabel, e.g. "digger:apply", runs "digger apply" if AuthorizeApply allows the user who added the label
+	ApplyLabel string
+	// AuthorizeApply tells whether the user may apply, the apply label is ignored when it isn't set
+	AuthorizeApply func(user string) (bool, error)
+}
+
+// ConvertGithubPullRequestLabelEventToJobs converts "labeled" pull request events adding one of the trigger labels
+// to jobs, other labels and "unlabeled" events don't trigger anything
+func ConvertGithubPullRequestLabelEventToJobs(payload *github.PullRequestEvent, impactedProjects []configuration.Project, workflows map[string]configuration.Workflow, triggers LabelTriggers) ([]orchestrator.Job, error) {
+	jobs := make([]orchestrator.Job, 0)
+	if payload.GetAction() != "labeled" {
+		return jobs, nil
+	}
+
+	label := payload.GetLabel().GetName()
+	user := payload.GetSender().GetLogin()
+	var applying bool
+	switch {
+	case label == "":
+		return jobs, nil
+	case label == triggers.PlanLabel:
+		// plans with the commands run on push
+	case label == triggers.ApplyLabel:
+		if triggers.AuthorizeApply == nil {
+			log.Printf("ignoring label %v, apply authorization isn't configured", label)
+			return jobs, nil
+		}
+		authorized, err := triggers.AuthorizeApply(user)
+		if err != nil {
+			return nil, fmt.Errorf("error authorizing apply for label %v: %v", label, err)
+		}
+		if !authorized {
+			return nil, fmt.Errorf("user %v is not allowed to apply with label %v", user, label)
+		}
+		applying = true
+	default:
+		return jobs, nil
+	}
+	log.Printf("label %v added by %v to PR #%d, applying: %v", label, user, payload.GetPullRequest().GetNumber(), applying)
+
+	return buildPullRequestJobs(impactedProjects, workflows, pullRequestJobContext{
+		pullRequestNumber: payload.PullRequest.Number,
+		eventName:         "pull_request",
+		namespace:         payload.GetRepo().GetFullName(),
+		requestedBy:       user,
+	}, func(workflow configuration.Workflow) []string {
+		if applying {
+			return []string{"digger apply"}
+		}
+		return workflow.Configuration.OnPullRequestPushed
+	})
+}
+
+// pullRequestJobContext holds the fields of jobs generated for a pull request event that don't depend on the project
+type pullRequestJobContext struct {
+	pullRequestNumber *int
+	eventName         string
+	namespace         string
+	requestedBy       string
+}
+
+// buildPullRequestJobs generates a job per impacted project running the commands returned by commandsFor for its
+// workflow, projects whose workflow has no commands for the event are skipped
+func buildPullRequestJobs(impactedProjects []configuration.Project, workflows map[string]configuration.Workflow, jobContext pullRequestJobContext, commandsFor func(workflow configuration.Workflow) []string) ([]orchestrator.Job, error) {
+	jobs := make([]orchestrator.Job, 0)
+	for _, project := range impactedProjects {
+		workflow, ok := workflows[project.Workflow]
+		if !ok {
+			return nil, fmt.Errorf("%w: failed to find workflow config '%s' for project '%s'", orchestrator.ErrWorkflowNotFound, project.Workflow, project.Name)
+		}
+
+		applyStage, err := orchestrator.ToConfigStage(workflow.Apply)
+		if err != nil {
+			return nil, fmt.Errorf("invalid apply stage in workflow '%s' for project '%s': %v", project.Workflow, project.Name, err)
+		}
+		planStage, err := orchestrator.ToConfigStage(workflow.Plan)
+		if err != nil {
+			return nil, fmt.Errorf("invalid plan stage in workflow '%s' for project '%s': %v", project.Workflow, project.Name, err)
+		}
+
+		commands := commandsFor(workflow)
+		if len(commands) == 0 {
+			continue
+		}
+
+		stateEnvVars, commandEnvVars := configuration.CollectTerraformEnvConfig(workflow.EnvVars)
+		commandEnvVars, scopedCommandEnvVars := orchestrator.SplitCommandScopedEnvVars(commandEnvVars)
+		jobs = append(jobs, orchestrator.Job{
+			ProjectName:          project.Name,
+			ProjectDir:           project.Dir,
+			ProjectWorkspace:     project.Workspace,
+			ProjectWorkflow:      project.Workflow,
+			WorkflowHash:         orchestrator.HashWorkflow(workflow),
+			Terragrunt:           project.Terragrunt,
+			DependsOn:            project.DependencyProjects,
+			Commands:             commands,
+			Action:               orchestrator.JobActionForCommands(commands),
+			ApplyStage:           applyStage,
+			PlanStage:            planStage,
+			CommandEnvVars:       commandEnvVars,
+			ScopedCommandEnvVars: scopedCommandEnvVars,
+			StateEnvVars:         stateEnvVars,
+			PullRequestNumber:    jobContext.pullRequestNumber,
+			EventName:            jobContext.eventName,
+			Namespace:            jobContext.namespace,
+			RequestedBy:          jobContext.requestedBy,
+		})
+	}
+	jobs = orchestrator.DeduplicateJobs(jobs)
+	if err := orchestrator.ValidateJobs(jobs); err != nil {
+		return nil, fmt.Errorf("invalid job generated: %v", err)
+	}
+	return jobs, nil
+}
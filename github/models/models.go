@@ -6,3 +6,9 @@ type EventPackage struct {
 	Actor      string
 	Repository string
 }
+
+// ScheduleEvent is the payload of workflows triggered on a schedule, go-github has no type for it
+type ScheduleEvent struct {
+	// Schedule is the cron expression that triggered the workflow
+	Schedule string `json:"schedule"`
+}
@@ -0,0 +1,69 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	orchestrator "github.com/diggerhq/lib-orchestrator"
+)
+
+// planArtifactsMarker identifies the comment of a pull request holding the plan artifacts of its projects
+const planArtifactsMarker = "<!-- digger-plan-artifacts -->"
+
+const planArtifactsHeader = planArtifactsMarker + "\n<sub>Digger keeps track of the plans of this pull request here to tell what changed when projects are planned again.</sub>"
+
+// planArtifactLine returns the hidden line of the artifacts comment holding the artifact of project
+func planArtifactLine(project string, artifact orchestrator.PlanArtifact) (string, error) {
+	content, err := json.Marshal(artifact)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("<!-- digger-plan-artifact:%v %s -->", project, content), nil
+}
+
+func planArtifactRegexp(project string) *regexp.Regexp {
+	return regexp.MustCompile(`<!-- digger-plan-artifact:` + regexp.QuoteMeta(project) + ` (\{.*?\}) -->`)
+}
+
+// StorePlanArtifact records the artifact of the latest plan of project in a hidden comment of the pull request,
+// replacing the artifact of the previous plan, so that LoadPreviousPlan returns it when the project is planned again
+func (svc *GithubService) StorePlanArtifact(prNumber int, project string, artifact orchestrator.PlanArtifact) error {
+	line, err := planArtifactLine(project, artifact)
+	if err != nil {
+		return fmt.Errorf("error encoding plan artifact of project %v: %v", project, err)
+	}
+	comment, err := svc.FindCommentByMarker(prNumber, planArtifactsMarker)
+	if err != nil {
+		return err
+	}
+	if comment == nil {
+		return svc.PublishComment(prNumber, planArtifactsHeader+"\n"+line)
+	}
+	return svc.UpdateComment(comment.Id.(int64), func(body string) string {
+		re := planArtifactRegexp(project)
+		if re.MatchString(body) {
+			return re.ReplaceAllLiteralString(body, line)
+		}
+		return strings.TrimRight(body, "\n") + "\n" + line
+	})
+}
+
+// LoadPreviousPlan returns the artifact stored by StorePlanArtifact for the last plan of project on the pull request,
+// or nil if the project wasn't planned yet
+func (svc *GithubService) LoadPreviousPlan(prNumber int, project string) (*orchestrator.PlanArtifact, error) {
+	comment, err := svc.FindCommentByMarker(prNumber, planArtifactsMarker)
+	if err != nil || comment == nil || comment.Body == nil {
+		return nil, err
+	}
+	match := planArtifactRegexp(project).FindStringSubmatch(*comment.Body)
+	if match == nil {
+		return nil, nil
+	}
+	var artifact orchestrator.PlanArtifact
+	if err := json.Unmarshal([]byte(match[1]), &artifact); err != nil {
+		return nil, fmt.Errorf("error decoding plan artifact of project %v: %v", project, err)
+	}
+	return &artifact, nil
+}
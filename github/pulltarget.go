@@ -0,0 +1,70 @@
+package github
+
+import (
+	"log"
+	"strings"
+
+	configuration "github.com/diggerhq/lib-digger-config"
+	orchestrator "github.com/diggerhq/lib-orchestrator"
+	"github.com/google/go-github/v55/github"
+)
+
+// ConvertGithubPullRequestTargetEventToJobs converts pull_request_target events, which run with the secrets of the
+// base repository to plan pull requests from forks, as ConvertGithubPullRequestEventToJobs does. Pull requests from
+// forks whose author isn't trusted, see IsTrustedAuthorAssociation, are only planned: their apply commands are dropped.
+func ConvertGithubPullRequestTargetEventToJobs(payload *github.PullRequestTargetEvent, impactedProjects []configuration.Project, requestedProject *configuration.Project, workflows map[string]configuration.Workflow) ([]orchestrator.Job, bool, error) {
+	jobs, coversAllImpactedProjects, err := ConvertGithubPullRequestEventToJobs(pullRequestEventFromTarget(payload), impactedProjects, requestedProject, workflows)
+	if err != nil {
+		return nil, false, err
+	}
+	return restrictPullRequestTargetJobs(payload, jobs), coversAllImpactedProjects, nil
+}
+
+// pullRequestEventFromTarget copies a pull_request_target event to the pull_request event it mirrors
+func pullRequestEventFromTarget(payload *github.PullRequestTargetEvent) *github.PullRequestEvent {
+	return &github.PullRequestEvent{
+		Action:            payload.Action,
+		Assignee:          payload.Assignee,
+		Number:            payload.Number,
+		PullRequest:       payload.PullRequest,
+		Changes:           payload.Changes,
+		RequestedReviewer: payload.RequestedReviewer,
+		RequestedTeam:     payload.RequestedTeam,
+		Repo:              payload.Repo,
+		Sender:            payload.Sender,
+		Installation:      payload.Installation,
+		Label:             payload.Label,
+		Organization:      payload.Organization,
+		Before:            payload.Before,
+		After:             payload.After,
+	}
+}
+
+// restrictPullRequestTargetJobs renames the event of jobs to pull_request_target and, for pull requests from forks of
+// untrusted authors, removes their apply commands and the jobs left without commands
+func restrictPullRequestTargetJobs(payload *github.PullRequestTargetEvent, jobs []orchestrator.Job) []orchestrator.Job {
+	pullRequest := payload.GetPullRequest()
+	fromFork := pullRequest.GetHead().GetRepo().GetFullName() != pullRequest.GetBase().GetRepo().GetFullName()
+	untrusted := fromFork && !IsTrustedAuthorAssociation(pullRequest.GetAuthorAssociation())
+
+	restricted := make([]orchestrator.Job, 0, len(jobs))
+	for _, job := range jobs {
+		job.EventName = orchestrator.EventPullRequestTarget.String()
+		if untrusted && containsCommand(job.Commands, "digger apply") {
+			commands := make([]string, 0, len(job.Commands))
+			for _, command := range job.Commands {
+				if strings.TrimSpace(command) != "digger apply" {
+					commands = append(commands, command)
+				}
+			}
+			log.Printf("not applying project %v for PR #%d from a fork, author association %v isn't trusted", job.ProjectName, pullRequest.GetNumber(), pullRequest.GetAuthorAssociation())
+			if len(commands) == 0 {
+				continue
+			}
+			job.Commands = commands
+			job.Action = orchestrator.JobActionForCommands(commands)
+		}
+		restricted = append(restricted, job)
+	}
+	return restricted
+}
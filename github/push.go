@@ -0,0 +1,50 @@
+package github
+
+import (
+	"log"
+
+	configuration "github.com/diggerhq/lib-digger-config"
+	orchestrator "github.com/diggerhq/lib-orchestrator"
+	"github.com/google/go-github/v55/github"
+)
+
+// ConvertGithubPushEventToJobs converts pushes to the default branch to a job per impacted project, as returned by
+// ProcessGitHubEvent, running the commands configured on commit to the default branch. Pushes whose head commit message contains skipToken, e.g.
+// orchestrator.DefaultSkipToken, generate no job.
+func ConvertGithubPushEventToJobs(payload *github.PushEvent, impactedProjects []configuration.Project, workflows map[string]configuration.Workflow, skipToken string) ([]orchestrator.Job, error) {
+	if orchestrator.ShouldSkipWithToken(payload.GetHeadCommit().GetMessage(), skipToken) {
+		log.Printf("skipping push of %v, its head commit message contains %v", payload.GetHeadCommit().GetID(), skipToken)
+		return []orchestrator.Job{}, nil
+	}
+	if payload.GetDeleted() || payload.GetRef() != "refs/heads/"+payload.GetRepo().GetDefaultBranch() {
+		return []orchestrator.Job{}, nil
+	}
+	return buildPullRequestJobs(impactedProjects, workflows, pullRequestJobContext{
+		eventName:   "push",
+		namespace:   payload.GetRepo().GetFullName(),
+		requestedBy: payload.GetSender().GetLogin(),
+	}, func(workflow configuration.Workflow) []string {
+		if workflow.Configuration == nil {
+			return nil
+		}
+		return workflow.Configuration.OnCommitToDefault
+	})
+}
+
+// PushChangedFiles returns the files added, modified or removed by the commits of a push. GitHub lists the files of
+// each commit in push payloads, so no API call is needed.
+func PushChangedFiles(payload *github.PushEvent) []string {
+	var files []string
+	seen := make(map[string]bool)
+	for _, commit := range payload.Commits {
+		for _, list := range [][]string{commit.Added, commit.Modified, commit.Removed} {
+			for _, file := range list {
+				if !seen[file] {
+					seen[file] = true
+					files = append(files, file)
+				}
+			}
+		}
+	}
+	return files
+}
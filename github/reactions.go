@@ -0,0 +1,129 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	orchestrator "github.com/diggerhq/lib-orchestrator"
+	"github.com/google/go-github/v55/github"
+)
+
+// GetReactions lists all reactions to the issue comment commentId, e.g. to require a "rocket" reaction from an
+// authorized user before running a destructive command
+func (svc *GithubService) GetReactions(commentId int64) ([]orchestrator.Reaction, error) {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	var reactions []orchestrator.Reaction
+	opts := &github.ListOptions{PerPage: svc.perPage()}
+	for {
+		page, resp, err := svc.Client.Reactions.ListIssueCommentReactions(ctx, svc.Owner, svc.RepoName, commentId, opts)
+		if err != nil {
+			return nil, fmt.Errorf("error listing reactions of comment %d: %w", commentId, checkPermissions(err))
+		}
+		for _, reaction := range page {
+			reactions = append(reactions, orchestrator.Reaction{
+				Id:      reaction.GetID(),
+				User:    reaction.GetUser().GetLogin(),
+				Content: reaction.GetContent(),
+			})
+		}
+		if resp.NextPage == 0 {
+			return reactions, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+const (
+	inProgressReaction = "eyes"
+	// GitHub has no check mark or cross reactions
+	successReaction = "+1"
+	failureReaction = "-1"
+)
+
+// SetCommandInProgressReaction reacts with 👀 to the comment commentId of a command being run
+func (svc *GithubService) SetCommandInProgressReaction(commentId int64) error {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	_, _, err := svc.Client.Reactions.CreateIssueCommentReaction(ctx, svc.Owner, svc.RepoName, commentId, inProgressReaction)
+	if err != nil {
+		return fmt.Errorf("error reacting to comment %d: %w", commentId, checkPermissions(err))
+	}
+	return nil
+}
+
+// SetCommandOutcomeReaction replaces the 👀 reaction of SetCommandInProgressReaction on the comment commentId of a
+// command with 👍 when the command succeeded for every project, or 👎 otherwise
+func (svc *GithubService) SetCommandOutcomeReaction(commentId int64, success bool) error {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	inProgress, err := svc.findOwnReaction(ctx, commentId, inProgressReaction)
+	if err != nil {
+		return fmt.Errorf("error getting in progress reaction of comment %d: %w", commentId, err)
+	}
+	if inProgress != nil {
+		_, err = svc.Client.Reactions.DeleteIssueCommentReaction(ctx, svc.Owner, svc.RepoName, commentId, inProgress.GetID())
+		if err != nil {
+			return fmt.Errorf("error removing in progress reaction of comment %d: %w", commentId, checkPermissions(err))
+		}
+	}
+
+	outcome := successReaction
+	if !success {
+		outcome = failureReaction
+	}
+	_, _, err = svc.Client.Reactions.CreateIssueCommentReaction(ctx, svc.Owner, svc.RepoName, commentId, outcome)
+	if err != nil {
+		return fmt.Errorf("error reacting to comment %d: %w", commentId, checkPermissions(err))
+	}
+	return nil
+}
+
+// findOwnReaction returns the reaction with content of the authenticated user to the comment commentId, or nil when
+// it has none
+func (svc *GithubService) findOwnReaction(ctx context.Context, commentId int64, content string) (*github.Reaction, error) {
+	login, err := svc.authenticatedLogin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// ListIssueCommentReactions has no content filter, which the API supports
+	query := url.Values{"content": {content}, "per_page": {strconv.Itoa(svc.perPage())}}
+	for page := 1; ; {
+		query.Set("page", strconv.Itoa(page))
+		u := fmt.Sprintf("repos/%v/%v/issues/comments/%d/reactions?%s", svc.Owner, svc.RepoName, commentId, query.Encode())
+		req, err := svc.Client.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		var reactions []*github.Reaction
+		resp, err := svc.Client.Do(ctx, req, &reactions)
+		if err != nil {
+			return nil, fmt.Errorf("error listing reactions: %w", checkPermissions(err))
+		}
+		for _, reaction := range reactions {
+			if reaction.GetContent() == content && strings.EqualFold(reaction.GetUser().GetLogin(), login) {
+				return reaction, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return nil, nil
+		}
+		page = resp.NextPage
+	}
+}
+
+// authenticatedLogin returns Login, or the login of the user the client authenticates as when it's empty
+func (svc *GithubService) authenticatedLogin(ctx context.Context) (string, error) {
+	if svc.Login != "" {
+		return svc.Login, nil
+	}
+	user, _, err := svc.Client.Users.Get(ctx, "")
+	if err != nil {
+		return "", fmt.Errorf("error getting the authenticated user, set Login when using installation tokens: %w", checkPermissions(err))
+	}
+	return user.GetLogin(), nil
+}
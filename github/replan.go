@@ -0,0 +1,93 @@
+package github
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	configuration "github.com/diggerhq/lib-digger-config"
+	orchestrator "github.com/diggerhq/lib-orchestrator"
+	"github.com/google/go-github/v55/github"
+)
+
+const defaultReplanConcurrency = 4
+
+// ListOpenPullRequests returns the open pull requests of the repository, most recently created first
+func (svc *GithubService) ListOpenPullRequests() ([]*github.PullRequest, error) {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	var pullRequests []*github.PullRequest
+	opts := &github.PullRequestListOptions{State: "open", ListOptions: github.ListOptions{PerPage: svc.perPage()}}
+	for {
+		page, resp, err := svc.Client.PullRequests.List(ctx, svc.Owner, svc.RepoName, opts)
+		if err != nil {
+			return nil, fmt.Errorf("error listing open pull requests: %w", checkPermissions(err))
+		}
+		pullRequests = append(pullRequests, page...)
+		if resp.NextPage == 0 {
+			return pullRequests, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// ReplanAllOpenPRs returns the plan jobs of every open pull request, e.g. after a change of a shared module was
+// merged, running the commands configured on push for the projects each pull request impacts. Jobs are tagged with
+// the number of their pull request and ordered as ListOpenPullRequests returns them. ReplanConcurrency pull requests
+// are looked up at a time to stay within the rate limits. A pull request failing doesn't stop the others: the jobs of
+// the pull requests that succeeded are returned along with the joined errors of those that failed.
+func (svc *GithubService) ReplanAllOpenPRs(cfg *configuration.DiggerConfig) ([]orchestrator.Job, error) {
+	pullRequests, err := svc.ListOpenPullRequests()
+	if err != nil {
+		return nil, err
+	}
+
+	concurrency := svc.ReplanConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultReplanConcurrency
+	}
+	jobsByPullRequest := make([][]orchestrator.Job, len(pullRequests))
+	errs := make([]error, len(pullRequests))
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, pullRequest := range pullRequests {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, pullRequest *github.PullRequest) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			jobs, err := svc.replanPullRequest(cfg, pullRequest)
+			if err != nil {
+				errs[i] = fmt.Errorf("error replanning PR #%d: %w", pullRequest.GetNumber(), err)
+				return
+			}
+			jobsByPullRequest[i] = jobs
+		}(i, pullRequest)
+	}
+	wg.Wait()
+
+	jobs := make([]orchestrator.Job, 0)
+	for _, pullRequestJobs := range jobsByPullRequest {
+		jobs = append(jobs, pullRequestJobs...)
+	}
+	return jobs, errors.Join(errs...)
+}
+
+func (svc *GithubService) replanPullRequest(cfg *configuration.DiggerConfig, pullRequest *github.PullRequest) ([]orchestrator.Job, error) {
+	changedFiles, err := svc.GetChangedFiles(pullRequest.GetNumber())
+	if err != nil {
+		return nil, err
+	}
+	impactedProjects := cfg.GetModifiedProjects(changedFiles)
+	return buildPullRequestJobs(impactedProjects, cfg.Workflows, pullRequestJobContext{
+		pullRequestNumber: pullRequest.Number,
+		eventName:         "pull_request",
+		namespace:         svc.Owner + "/" + svc.RepoName,
+		requestedBy:       pullRequest.GetUser().GetLogin(),
+	}, func(workflow configuration.Workflow) []string {
+		if workflow.Configuration == nil {
+			return nil
+		}
+		return workflow.Configuration.OnPullRequestPushed
+	})
+}
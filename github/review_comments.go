@@ -0,0 +1,251 @@
+package github
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	configuration "github.com/diggerhq/lib-digger-config"
+	orchestrator "github.com/diggerhq/lib-orchestrator"
+	"github.com/google/go-github/v55/github"
+)
+
+// CreateReviewComment annotates line (in the new version of the file) of path in the pull request diff and returns
+// the GraphQL ID of the review thread it started. GitHub only accepts review comments on lines that are part of a diff
+// hunk, so lines outside of the diff return an error.
+func (svc *GithubService) CreateReviewComment(prNumber int, path string, line int, body string) (string, error) {
+	_, headSHA, err := svc.GetBaseAndHeadSHA(prNumber)
+	if err != nil {
+		return "", err
+	}
+
+	patch, err := svc.getFilePatch(prNumber, path)
+	if err != nil {
+		return "", err
+	}
+	if !isLineInPatch(patch, line) {
+		return "", fmt.Errorf("line %d of %v is not part of the pull request diff", line, path)
+	}
+
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	side := "RIGHT"
+	comment, _, err := svc.Client.PullRequests.CreateComment(ctx, svc.Owner, svc.RepoName, prNumber, &github.PullRequestComment{
+		Body:     &body,
+		CommitID: &headSHA,
+		Path:     &path,
+		Line:     &line,
+		Side:     &side,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error creating review comment on %v:%d: %w", path, line, checkPermissions(err))
+	}
+
+	threadID, err := svc.GetReviewThreadID(prNumber, comment.GetID())
+	if err != nil {
+		return "", fmt.Errorf("review comment %d created but its thread couldn't be found: %v", comment.GetID(), err)
+	}
+	return threadID, nil
+}
+
+const reviewThreadsQuery = `query($owner: String!, $repo: String!, $number: Int!, $cursor: String) {
+  repository(owner: $owner, name: $repo) {
+    pullRequest(number: $number) {
+      reviewThreads(first: 100, after: $cursor) {
+        nodes {
+          id
+          comments(first: 1) {
+            nodes {
+              databaseId
+            }
+          }
+        }
+        pageInfo {
+          hasNextPage
+          endCursor
+        }
+      }
+    }
+  }
+}`
+
+type reviewThreadsResult struct {
+	Repository struct {
+		PullRequest struct {
+			ReviewThreads struct {
+				Nodes []struct {
+					ID       string `json:"id"`
+					Comments struct {
+						Nodes []struct {
+							DatabaseID int64 `json:"databaseId"`
+						} `json:"nodes"`
+					} `json:"comments"`
+				} `json:"nodes"`
+				PageInfo struct {
+					HasNextPage bool   `json:"hasNextPage"`
+					EndCursor   string `json:"endCursor"`
+				} `json:"pageInfo"`
+			} `json:"reviewThreads"`
+		} `json:"pullRequest"`
+	} `json:"repository"`
+}
+
+// GetReviewThreadID returns the GraphQL ID of the review thread started by the review comment commentId
+func (svc *GithubService) GetReviewThreadID(prNumber int, commentId int64) (string, error) {
+	variables := map[string]interface{}{
+		"owner":  svc.Owner,
+		"repo":   svc.RepoName,
+		"number": prNumber,
+	}
+	for {
+		var result reviewThreadsResult
+		err := svc.graphQL(reviewThreadsQuery, variables, &result)
+		if err != nil {
+			return "", err
+		}
+		threads := result.Repository.PullRequest.ReviewThreads
+		for _, thread := range threads.Nodes {
+			if len(thread.Comments.Nodes) > 0 && thread.Comments.Nodes[0].DatabaseID == commentId {
+				return thread.ID, nil
+			}
+		}
+		if !threads.PageInfo.HasNextPage {
+			return "", fmt.Errorf("no review thread found for comment %d", commentId)
+		}
+		variables["cursor"] = threads.PageInfo.EndCursor
+	}
+}
+
+func (svc *GithubService) ResolveReviewThread(threadID string) error {
+	err := svc.graphQL(`mutation($threadId: ID!) {
+  resolveReviewThread(input: {threadId: $threadId}) {
+    thread {
+      id
+    }
+  }
+}`, map[string]interface{}{"threadId": threadID}, nil)
+	if err != nil {
+		return fmt.Errorf("error resolving review thread %v: %v", threadID, err)
+	}
+	return nil
+}
+
+func (svc *GithubService) UnresolveReviewThread(threadID string) error {
+	err := svc.graphQL(`mutation($threadId: ID!) {
+  unresolveReviewThread(input: {threadId: $threadId}) {
+    thread {
+      id
+    }
+  }
+}`, map[string]interface{}{"threadId": threadID}, nil)
+	if err != nil {
+		return fmt.Errorf("error unresolving review thread %v: %v", threadID, err)
+	}
+	return nil
+}
+
+func (svc *GithubService) getFilePatch(prNumber int, path string) (string, error) {
+	ctx, cancel := svc.operationContext()
+	defer cancel()
+	opts := &github.ListOptions{PerPage: svc.perPage()}
+	for {
+		files, resp, err := svc.Client.PullRequests.ListFiles(ctx, svc.Owner, svc.RepoName, prNumber, opts)
+		if err != nil {
+			return "", fmt.Errorf("error getting pull request files: %w", checkPermissions(err))
+		}
+		for _, file := range files {
+			if file.GetFilename() == path {
+				return file.GetPatch(), nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return "", fmt.Errorf("file %v is not changed by pull request %d", path, prNumber)
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+var hunkHeaderRegex = regexp.MustCompile(`(?m)^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+// isLineInPatch checks whether line of the new file falls into one of the hunks of the unified diff patch
+func isLineInPatch(patch string, line int) bool {
+	for _, match := range hunkHeaderRegex.FindAllStringSubmatch(patch, -1) {
+		start, _ := strconv.Atoi(match[1])
+		length := 1
+		if match[2] != "" {
+			length, _ = strconv.Atoi(match[2])
+		}
+		if line >= start && line < start+length {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatSuggestion wraps replacement in a GitHub suggestion block, rendered with a "Commit suggestion" button that
+// replaces the commented line with replacement
+func FormatSuggestion(replacement string) string {
+	fence := "```"
+	for strings.Contains(replacement, fence) {
+		fence += "`"
+	}
+	return fence + "suggestion\n" + strings.TrimSuffix(replacement, "\n") + "\n" + fence
+}
+
+// CreateSuggestionComment posts a review comment on line of path suggesting to replace it with replacement,
+// message is shown above the suggestion. It returns the ID of the review thread.
+func (svc *GithubService) CreateSuggestionComment(prNumber int, path string, line int, replacement string, message string) (string, error) {
+	body := FormatSuggestion(replacement)
+	if message != "" {
+		body = message + "\n\n" + body
+	}
+	return svc.CreateReviewComment(prNumber, path, line, body)
+}
+
+var ErrFileNotInProject = errors.New("file doesn't belong to any impacted project")
+
+// reviewCommentCommands are the commands that can be commented on a file of a pull request
+var reviewCommentCommands = orchestrator.CommandRegistry{"digger plan": orchestrator.JobActionTerraform}
+
+// ConvertGithubPullRequestReviewCommentEventToJobs converts "digger plan" commented on a file of a pull request to a
+// plan of the projects of that file, which ProcessGitHubEvent returns as the impacted projects of the event
+func ConvertGithubPullRequestReviewCommentEventToJobs(payload *github.PullRequestReviewCommentEvent, impactedProjects []configuration.Project, workflows map[string]configuration.Workflow) ([]orchestrator.Job, error) {
+	if payload.GetAction() != "created" {
+		return []orchestrator.Job{}, nil
+	}
+	issueComment := &github.IssueCommentEvent{
+		Comment: &github.IssueComment{Body: payload.GetComment().Body},
+		Issue:   &github.Issue{Number: payload.GetPullRequest().Number},
+		Repo:    payload.Repo,
+		Sender:  payload.Sender,
+	}
+	jobs, _, err := ConvertGithubIssueCommentEventToJobsWithCommands(issueComment, impactedProjects, nil, workflows, reviewCommentCommands)
+	if err != nil {
+		return nil, err
+	}
+	for i := range jobs {
+		jobs[i].EventName = orchestrator.EventPullRequestReviewComment.String()
+	}
+	return jobs, nil
+}
+
+// filterProjectsOfFile returns the impacted projects path belongs to, with an error wrapping ErrFileNotInProject when
+// there is none
+func filterProjectsOfFile(diggerConfig *configuration.DiggerConfig, impactedProjects []configuration.Project, path string) ([]configuration.Project, error) {
+	fileProjects := diggerConfig.GetModifiedProjects([]string{path})
+	projects := make([]configuration.Project, 0)
+	for _, project := range impactedProjects {
+		for _, fileProject := range fileProjects {
+			if project.Name == fileProject.Name {
+				projects = append(projects, project)
+				break
+			}
+		}
+	}
+	if len(projects) == 0 {
+		return nil, fmt.Errorf("%w: %v", ErrFileNotInProject, path)
+	}
+	return projects, nil
+}
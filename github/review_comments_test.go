@@ -0,0 +1,22 @@
+package github
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestIsLineInPatch(t *testing.T) {
+	patch := "@@ -1,3 +1,4 @@\n resource \"a\" \"b\" {\n+  name = \"c\"\n }\n@@ -20 +21,2 @@\n-x\n+y\n+z"
+
+	assert.True(t, isLineInPatch(patch, 1))
+	assert.True(t, isLineInPatch(patch, 4))
+	assert.False(t, isLineInPatch(patch, 5))
+	assert.True(t, isLineInPatch(patch, 22))
+	assert.False(t, isLineInPatch(patch, 23))
+	assert.False(t, isLineInPatch("", 1))
+}
+
+func TestFormatSuggestion(t *testing.T) {
+	assert.Equal(t, "```suggestion\n  name = \"c\"\n```", FormatSuggestion("  name = \"c\"\n"))
+	assert.Equal(t, "````suggestion\n```hcl\n````", FormatSuggestion("```hcl"))
+}
@@ -0,0 +1,55 @@
+package github
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	configuration "github.com/diggerhq/lib-digger-config"
+	orchestrator "github.com/diggerhq/lib-orchestrator"
+	"github.com/google/go-github/v55/github"
+)
+
+// ReviewTriggers configures the pull request reviews that trigger jobs when they are submitted
+type ReviewTriggers struct {
+	// ApplyOnApproval runs "digger apply" when a pull request is approved, reviews don't trigger anything otherwise
+	ApplyOnApproval bool
+	// AuthorizeApply tells whether the reviewer may apply, approvals are ignored when it isn't set
+	AuthorizeApply func(user string) (bool, error)
+}
+
+// ConvertGithubPullRequestReviewEventToJobs converts approvals submitted on a pull request to apply jobs, reviews
+// commenting or requesting changes don't trigger anything
+func ConvertGithubPullRequestReviewEventToJobs(payload *github.PullRequestReviewEvent, impactedProjects []configuration.Project, workflows map[string]configuration.Workflow, triggers ReviewTriggers) ([]orchestrator.Job, error) {
+	jobs := make([]orchestrator.Job, 0)
+	if !triggers.ApplyOnApproval || payload.GetAction() != "submitted" {
+		return jobs, nil
+	}
+	// the state is in lower case in webhook payloads and in upper case in the REST API
+	if strings.ToLower(payload.GetReview().GetState()) != "approved" {
+		return jobs, nil
+	}
+
+	user := payload.GetReview().GetUser().GetLogin()
+	if triggers.AuthorizeApply == nil {
+		log.Printf("ignoring approval of %v, apply authorization isn't configured", user)
+		return jobs, nil
+	}
+	authorized, err := triggers.AuthorizeApply(user)
+	if err != nil {
+		return nil, fmt.Errorf("error authorizing apply on approval: %v", err)
+	}
+	if !authorized {
+		return nil, fmt.Errorf("user %v is not allowed to apply by approving", user)
+	}
+	log.Printf("PR #%d approved by %v, applying", payload.GetPullRequest().GetNumber(), user)
+
+	return buildPullRequestJobs(impactedProjects, workflows, pullRequestJobContext{
+		pullRequestNumber: payload.GetPullRequest().Number,
+		eventName:         "pull_request_review",
+		namespace:         payload.GetRepo().GetFullName(),
+		requestedBy:       user,
+	}, func(workflow configuration.Workflow) []string {
+		return []string{"digger apply"}
+	})
+}
@@ -0,0 +1,218 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	orchestrator "github.com/diggerhq/lib-orchestrator"
+	"github.com/google/go-github/v55/github"
+)
+
+// StatusReporter publishes the state ("pending", "success", "failure", "error") of a commit under a context name,
+// ctx carries the operation timeout of the service
+type StatusReporter interface {
+	ReportStatus(ctx context.Context, sha string, status string, statusContext string, description string) error
+}
+
+// CommitStatusReporter reports through the commit statuses API, the default
+type CommitStatusReporter struct {
+	Client   *github.Client
+	Owner    string
+	RepoName string
+}
+
+func (r *CommitStatusReporter) ReportStatus(ctx context.Context, sha string, status string, statusContext string, description string) error {
+	_, _, err := r.Client.Repositories.CreateStatus(ctx, r.Owner, r.RepoName, sha, &github.RepoStatus{
+		State:       &status,
+		Context:     &statusContext,
+		Description: &description,
+	})
+	return err
+}
+
+// CheckRunReporter reports through the checks API, for repositories where commit statuses are disallowed. The status
+// context is used as the check run name and an existing check run with that name is updated in place.
+// Creating check runs requires authenticating as a GitHub App.
+type CheckRunReporter struct {
+	Client   *github.Client
+	Owner    string
+	RepoName string
+}
+
+func (r *CheckRunReporter) ReportStatus(ctx context.Context, sha string, status string, statusContext string, description string) error {
+	checkStatus := "completed"
+	var conclusion *string
+	switch status {
+	case "pending":
+		checkStatus = "in_progress"
+	case "success":
+		conclusion = github.String("success")
+	case "failure", "error":
+		conclusion = github.String("failure")
+	default:
+		return fmt.Errorf("unsupported status: %v", status)
+	}
+	output := &github.CheckRunOutput{
+		Title:   &description,
+		Summary: &description,
+	}
+
+	checkRuns, _, err := r.Client.Checks.ListCheckRunsForRef(ctx, r.Owner, r.RepoName, sha, &github.ListCheckRunsOptions{
+		CheckName: &statusContext,
+	})
+	if err != nil {
+		return fmt.Errorf("error listing check runs: %v", err)
+	}
+
+	if len(checkRuns.CheckRuns) > 0 {
+		_, _, err = r.Client.Checks.UpdateCheckRun(ctx, r.Owner, r.RepoName, checkRuns.CheckRuns[0].GetID(), github.UpdateCheckRunOptions{
+			Name:       statusContext,
+			Status:     &checkStatus,
+			Conclusion: conclusion,
+			Output:     output,
+		})
+		return err
+	}
+
+	_, _, err = r.Client.Checks.CreateCheckRun(ctx, r.Owner, r.RepoName, github.CreateCheckRunOptions{
+		Name:       statusContext,
+		HeadSHA:    sha,
+		Status:     &checkStatus,
+		Conclusion: conclusion,
+		Output:     output,
+	})
+	return err
+}
+
+func (svc *GithubService) statusReporter() StatusReporter {
+	if svc.StatusReporter != nil {
+		return svc.StatusReporter
+	}
+	return &CommitStatusReporter{
+		Client:   svc.Client,
+		Owner:    svc.Owner,
+		RepoName: svc.RepoName,
+	}
+}
+
+// StatusUpdate is a job status set by SetStatuses
+type StatusUpdate struct {
+	Status        orchestrator.JobStatus
+	StatusContext string
+}
+
+const (
+	defaultStatusConcurrency   = 4
+	maxStatusAttempts          = 3
+	initialStatusRetryInterval = time.Second
+)
+
+// SetStatuses sets many job statuses on the head of a pull request, e.g. a pending status per project when it is
+// opened. The head is looked up once, StatusConcurrency statuses are set at a time and those hitting the secondary
+// rate limit are retried with backoff. The errors of all failed updates are joined.
+func (svc *GithubService) SetStatuses(prNumber int, updates []StatusUpdate) error {
+	_, headSHA, err := svc.GetBaseAndHeadSHA(prNumber)
+	if err != nil {
+		return checkPermissions(err)
+	}
+
+	concurrency := svc.StatusConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultStatusConcurrency
+	}
+	reporter := svc.statusReporter()
+	errs := make([]error, len(updates))
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, update := range updates {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, update StatusUpdate) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			if err := svc.reportStatusWithRetry(reporter, headSHA, update); err != nil {
+				errs[i] = fmt.Errorf("error setting status %v: %w", update.StatusContext, err)
+			}
+		}(i, update)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// reportStatusWithRetry reports a status, waiting for as long as GitHub asks, or with exponential backoff, when the
+// secondary rate limit is hit
+func (svc *GithubService) reportStatusWithRetry(reporter StatusReporter, sha string, update StatusUpdate) error {
+	interval := initialStatusRetryInterval
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := svc.operationContext()
+		err := reporter.ReportStatus(ctx, sha, update.Status.CommitState(), update.StatusContext, update.Status.Description())
+		cancel()
+		var rateLimitErr *github.AbuseRateLimitError
+		if err == nil || !errors.As(err, &rateLimitErr) || attempt == maxStatusAttempts {
+			return checkPermissions(err)
+		}
+		wait := interval
+		if rateLimitErr.RetryAfter != nil {
+			wait = *rateLimitErr.RetryAfter
+		}
+		time.Sleep(wait)
+		interval *= 2
+	}
+}
+
+// SetJobResultStatuses sets a status per project, under the StatusContext of its command and project, and the
+// aggregate of the results under aggregateContext so that branch protection can require a single status
+func (svc *GithubService) SetJobResultStatuses(prNumber int, results []orchestrator.JobResult, aggregateContext string) error {
+	updates := make([]StatusUpdate, 0, len(results))
+	failed, pending := 0, 0
+	for _, result := range results {
+		status := result.Status
+		switch {
+		case result.Error != nil || status.CommitState() != "success" && status.CommitState() != "pending":
+			failed++
+			status = failedStatus(status)
+		case status.CommitState() == "pending":
+			pending++
+		}
+		updates = append(updates, StatusUpdate{Status: status, StatusContext: orchestrator.StatusContext(result.Command, result.Project)})
+	}
+	if err := svc.SetStatuses(prNumber, updates); err != nil {
+		return err
+	}
+
+	state := orchestrator.AggregateState(results)
+	description := fmt.Sprintf("%d projects succeeded", len(results))
+	switch state {
+	case "failure":
+		description = fmt.Sprintf("%d of %d projects failed", failed, len(results))
+	case "pending":
+		description = fmt.Sprintf("%d of %d projects in progress", pending, len(results))
+	}
+	return svc.setStatus(prNumber, state, aggregateContext, description)
+}
+
+// failedStatus returns the failed status of the command of status
+func failedStatus(status orchestrator.JobStatus) orchestrator.JobStatus {
+	switch status {
+	case orchestrator.ApplyPending, orchestrator.ApplySucceeded, orchestrator.ApplyFailed:
+		return orchestrator.ApplyFailed
+	}
+	return orchestrator.PlanFailed
+}
+
+// HasSuccessfulPlan reports whether project was planned successfully on the pull request head, from the status
+// context StatusContext("plan", project) set by the plan job. It is false when the head wasn't planned yet, e.g.
+// after a new push, so that "digger apply" can be refused until a plan succeeded.
+func (svc *GithubService) HasSuccessfulPlan(prNumber int, project string) (bool, error) {
+	state, err := svc.GetStatusForContext(prNumber, orchestrator.StatusContext("plan", project))
+	if errors.Is(err, ErrStatusContextNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return state == "success", nil
+}
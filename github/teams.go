@@ -0,0 +1,51 @@
+package github
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultTeamCacheTTL = 60 * time.Second
+
+// TeamCache keeps the teams returned by GetUserTeams for a short time, so that the authorization checks of the
+// projects of a pull request don't list the teams again. Set it on GithubService.TeamCache, it is safe to share
+// between copies of the service.
+type TeamCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]cachedTeams
+}
+
+type cachedTeams struct {
+	teams   []string
+	expires time.Time
+}
+
+// NewTeamCache creates a cache keeping teams for ttl, 60 seconds when ttl isn't positive
+func NewTeamCache(ttl time.Duration) *TeamCache {
+	if ttl <= 0 {
+		ttl = defaultTeamCacheTTL
+	}
+	return &TeamCache{ttl: ttl, entries: make(map[string]cachedTeams)}
+}
+
+func (c *TeamCache) get(organisation string, user string) ([]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[teamCacheKey(organisation, user)]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	// callers may modify the returned slice
+	return append([]string(nil), entry.teams...), true
+}
+
+func (c *TeamCache) set(organisation string, user string, teams []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[teamCacheKey(organisation, user)] = cachedTeams{teams: teams, expires: time.Now().Add(c.ttl)}
+}
+
+func teamCacheKey(organisation string, user string) string {
+	return organisation + "/" + user
+}
@@ -0,0 +1,157 @@
+package github
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// ResponseCache stores response bodies by request URL along with their ETag, implement it to share the cache
+// between processes, e.g. backed by Redis
+type ResponseCache interface {
+	Get(key string) (etag string, body []byte, ok bool)
+	Set(key string, etag string, body []byte)
+}
+
+type InMemoryResponseCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedResponse
+}
+
+type cachedResponse struct {
+	etag string
+	body []byte
+}
+
+func NewInMemoryResponseCache() *InMemoryResponseCache {
+	return &InMemoryResponseCache{entries: make(map[string]cachedResponse)}
+}
+
+func (c *InMemoryResponseCache) Get(key string) (string, []byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	return entry.etag, entry.body, ok
+}
+
+func (c *InMemoryResponseCache) Set(key string, etag string, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = cachedResponse{etag: etag, body: body}
+}
+
+// etagTransport sends conditional GET requests with If-None-Match and serves the cached body when the API answers
+// 304 Not Modified, which doesn't count against the rate limit
+type etagTransport struct {
+	base  http.RoundTripper
+	cache ResponseCache
+}
+
+func (t *etagTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.base.RoundTrip(req)
+	}
+
+	key := req.URL.String()
+	etag, cachedBody, cached := t.cache.Get(key)
+	if cached {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached {
+		resp.Body.Close()
+		resp.StatusCode = http.StatusOK
+		resp.Status = "200 OK"
+		resp.Body = io.NopCloser(bytes.NewReader(cachedBody))
+		resp.ContentLength = int64(len(cachedBody))
+		return resp, nil
+	}
+
+	if resp.StatusCode == http.StatusOK && resp.Header.Get("ETag") != "" {
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		t.cache.Set(key, resp.Header.Get("ETag"), body)
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	return resp, nil
+}
+
+// TokenSource mints a new API token, e.g. a fresh GitHub App installation token once the previous one expired
+type TokenSource func() (string, error)
+
+// refreshingTokenTransport authenticates requests with the current token and, when the API answers 401 Unauthorized,
+// mints a new token from tokenSource and retries the request once
+type refreshingTokenTransport struct {
+	base        http.RoundTripper
+	tokenSource TokenSource
+
+	mu    sync.Mutex
+	token string
+}
+
+func (t *refreshingTokenTransport) currentToken() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.token
+}
+
+// refreshToken mints a new token unless another request already replaced usedToken in the meantime
+func (t *refreshingTokenTransport) refreshToken(usedToken string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != usedToken {
+		return t.token, nil
+	}
+	token, err := t.tokenSource()
+	if err != nil {
+		return "", err
+	}
+	t.token = token
+	return token, nil
+}
+
+func (t *refreshingTokenTransport) authenticatedRequest(req *http.Request, token string) *http.Request {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func (t *refreshingTokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token := t.currentToken()
+	resp, err := t.base.RoundTrip(t.authenticatedRequest(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	// the body of the first attempt was consumed, requests whose body can't be recreated aren't retried
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+
+	newToken, err := t.refreshToken(token)
+	if err != nil {
+		// the caller gets the 401 response, log why it wasn't retried
+		log.Printf("failed to refresh token after unauthorized response: %v", err)
+		return resp, nil
+	}
+	retry := t.authenticatedRequest(req, newToken)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry.Body = body
+	}
+	resp.Body.Close()
+	return t.base.RoundTrip(retry)
+}
@@ -0,0 +1,151 @@
+package github
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRefreshingTokenTransportRetriesOnce(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	minted := 0
+	transport := &refreshingTokenTransport{
+		base:  http.DefaultTransport,
+		token: "expired",
+		tokenSource: func() (string, error) {
+			minted++
+			return "fresh", nil
+		},
+	}
+	client := &http.Client{Transport: transport}
+
+	resp, err := client.Get(server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, 1, minted)
+
+	// the refreshed token is reused for later requests
+	resp, err = client.Get(server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 3, requests)
+	assert.Equal(t, 1, minted)
+
+	// a token that is still rejected after refreshing isn't retried again
+	requests = 0
+	transport.token = "expired"
+	transport.tokenSource = func() (string, error) {
+		return "revoked", nil
+	}
+	resp, err = client.Get(server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, 2, requests)
+}
+
+func TestEtagTransport(t *testing.T) {
+	var ifNoneMatch []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ifNoneMatch = append(ifNoneMatch, r.Header.Get("If-None-Match"))
+		if r.Method == http.MethodGet && r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, "cached body")
+	}))
+	defer server.Close()
+
+	cache := NewInMemoryResponseCache()
+	client := &http.Client{Transport: &etagTransport{base: http.DefaultTransport, cache: cache}}
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL + "/repos/diggerhq/demo")
+		assert.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "cached body", string(body))
+	}
+	assert.Equal(t, []string{"", `"v1"`}, ifNoneMatch)
+
+	// other methods are neither conditional nor cached
+	resp, err := client.Post(server.URL+"/repos/diggerhq/demo", "application/json", strings.NewReader("{}"))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "", ifNoneMatch[2])
+	_, _, cached := cache.Get(server.URL + "/repos/diggerhq/demo")
+	assert.True(t, cached)
+}
+
+func TestNewGitHubServiceWithOptionsCombinesCacheAndTokenSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, `{"number": 1, "body": "description"}`)
+	}))
+	defer server.Close()
+
+	svc, err := NewGitHubServiceWithOptions("expired", "demo", "diggerhq", ServiceOptions{
+		Cache:       NewInMemoryResponseCache(),
+		TokenSource: func() (string, error) { return "fresh", nil },
+	})
+	assert.NoError(t, err)
+	baseURL, _ := url.Parse(server.URL + "/")
+	svc.Client.BaseURL = baseURL
+
+	for i := 0; i < 2; i++ {
+		body, err := svc.GetPullRequestBody(1)
+		assert.NoError(t, err)
+		assert.Equal(t, "description", body)
+	}
+}
+
+func TestNewGitHubServiceWithOptionsUsesProxy(t *testing.T) {
+	proxied := 0
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied++
+		// proxies receive the absolute URL of the target
+		assert.Equal(t, "github.invalid", r.URL.Host)
+		assert.Equal(t, "Bearer fresh", r.Header.Get("Authorization"))
+		fmt.Fprint(w, `{"number": 1, "body": "description"}`)
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	svc, err := NewGitHubServiceWithOptions("fresh", "demo", "diggerhq", ServiceOptions{
+		Cache:         NewInMemoryResponseCache(),
+		TokenSource:   func() (string, error) { return "fresh", nil },
+		BaseTransport: &http.Transport{Proxy: http.ProxyURL(proxyURL)},
+	})
+	assert.NoError(t, err)
+	svc.Client.BaseURL, _ = url.Parse("http://github.invalid/")
+
+	body, err := svc.GetPullRequestBody(1)
+	assert.NoError(t, err)
+	assert.Equal(t, "description", body)
+	assert.Equal(t, 1, proxied)
+}
@@ -2,62 +2,90 @@ package orchestrator
 
 type StepJson struct {
 	Action    string   `json:"action"`
+	Value     string   `json:"value"`
 	ExtraArgs []string `json:"extraArgs"`
+	Shell     string   `json:"shell"`
 }
 
 type StageJson struct {
 	Steps []StepJson `json:"steps"`
 }
 
+// JobJson is the wire format of Job used by JobToJson and JsonToJob, it carries the same fields under the same JSON
+// names as Job itself
 type JobJson struct {
-	ProjectName       string            `json:"projectName"`
-	ProjectDir        string            `json:"projectDir"`
-	ProjectWorkspace  string            `json:"projectWorkspace"`
-	Terragrunt        bool              `json:"terragrunt"`
-	Commands          []string          `json:"commands"`
-	ApplyStage        StageJson         `json:"applyStage"`
-	PlanStage         StageJson         `json:"planStage"`
-	PullRequestNumber *int              `json:"pullRequestNumber"`
-	EventName         string            `json:"eventName"`
-	RequestedBy       string            `json:"requestedBy"`
-	Namespace         string            `json:"namespace"`
-	StateEnvVars      map[string]string `json:"stateEnvVars"`
-	CommandEnvVars    map[string]string `json:"commandEnvVars"`
+	ProjectName          string                       `json:"projectName"`
+	ProjectDir           string                       `json:"projectDir"`
+	ProjectWorkspace     string                       `json:"projectWorkspace"`
+	ProjectWorkflow      string                       `json:"projectWorkflow"`
+	WorkflowHash         string                       `json:"workflowHash"`
+	Terragrunt           bool                         `json:"terragrunt"`
+	DependsOn            []string                     `json:"dependsOn"`
+	Commands             []string                     `json:"commands"`
+	Action               JobAction                    `json:"action"`
+	CommandArgs          []string                     `json:"commandArgs"`
+	NoColor              bool                         `json:"noColor"`
+	Verbose              bool                         `json:"verbose"`
+	ApplyStage           StageJson                    `json:"applyStage"`
+	PlanStage            StageJson                    `json:"planStage"`
+	PullRequestNumber    *int                         `json:"pullRequestNumber"`
+	EventName            string                       `json:"eventName"`
+	RequestedBy          string                       `json:"requestedBy"`
+	Namespace            string                       `json:"namespace"`
+	StateEnvVars         map[string]string            `json:"stateEnvVars"`
+	CommandEnvVars       map[string]string            `json:"commandEnvVars"`
+	ScopedCommandEnvVars map[string]map[string]string `json:"scopedCommandEnvVars"`
 }
 
 func JobToJson(job Job) JobJson {
 	return JobJson{
-		ProjectName:       job.ProjectName,
-		ProjectDir:        job.ProjectDir,
-		ProjectWorkspace:  job.ProjectWorkspace,
-		Terragrunt:        job.Terragrunt,
-		Commands:          job.Commands,
-		ApplyStage:        stageToJson(job.ApplyStage),
-		PlanStage:         stageToJson(job.PlanStage),
-		PullRequestNumber: job.PullRequestNumber,
-		EventName:         job.EventName,
-		RequestedBy:       job.RequestedBy,
-		Namespace:         job.Namespace,
-		StateEnvVars:      job.StateEnvVars,
-		CommandEnvVars:    job.CommandEnvVars,
+		ProjectName:          job.ProjectName,
+		ProjectDir:           job.ProjectDir,
+		ProjectWorkspace:     job.ProjectWorkspace,
+		ProjectWorkflow:      job.ProjectWorkflow,
+		WorkflowHash:         job.WorkflowHash,
+		Terragrunt:           job.Terragrunt,
+		DependsOn:            job.DependsOn,
+		Commands:             job.Commands,
+		Action:               job.Action,
+		CommandArgs:          job.CommandArgs,
+		NoColor:              job.NoColor,
+		Verbose:              job.Verbose,
+		ApplyStage:           stageToJson(job.ApplyStage),
+		PlanStage:            stageToJson(job.PlanStage),
+		PullRequestNumber:    job.PullRequestNumber,
+		EventName:            job.EventName,
+		RequestedBy:          job.RequestedBy,
+		Namespace:            job.Namespace,
+		StateEnvVars:         job.StateEnvVars,
+		CommandEnvVars:       job.CommandEnvVars,
+		ScopedCommandEnvVars: job.ScopedCommandEnvVars,
 	}
 }
 
 func JsonToJob(jobJson JobJson) Job {
 	return Job{
-		ProjectName:       jobJson.ProjectName,
-		ProjectDir:        jobJson.ProjectDir,
-		ProjectWorkspace:  jobJson.ProjectWorkspace,
-		Terragrunt:        jobJson.Terragrunt,
-		Commands:          jobJson.Commands,
-		ApplyStage:        jsonToStage(jobJson.ApplyStage),
-		PlanStage:         jsonToStage(jobJson.PlanStage),
-		PullRequestNumber: jobJson.PullRequestNumber,
-		EventName:         jobJson.EventName,
-		RequestedBy:       jobJson.RequestedBy,
-		Namespace:         jobJson.Namespace,
-		StateEnvVars:      jobJson.StateEnvVars,
-		CommandEnvVars:    jobJson.CommandEnvVars,
+		ProjectName:          jobJson.ProjectName,
+		ProjectDir:           jobJson.ProjectDir,
+		ProjectWorkspace:     jobJson.ProjectWorkspace,
+		ProjectWorkflow:      jobJson.ProjectWorkflow,
+		WorkflowHash:         jobJson.WorkflowHash,
+		Terragrunt:           jobJson.Terragrunt,
+		DependsOn:            jobJson.DependsOn,
+		Commands:             jobJson.Commands,
+		Action:               jobJson.Action,
+		CommandArgs:          jobJson.CommandArgs,
+		NoColor:              jobJson.NoColor,
+		Verbose:              jobJson.Verbose,
+		ApplyStage:           jsonToStage(jobJson.ApplyStage),
+		PlanStage:            jsonToStage(jobJson.PlanStage),
+		PullRequestNumber:    jobJson.PullRequestNumber,
+		EventName:            jobJson.EventName,
+		RequestedBy:          jobJson.RequestedBy,
+		Namespace:            jobJson.Namespace,
+		StateEnvVars:         jobJson.StateEnvVars,
+		CommandEnvVars:       jobJson.CommandEnvVars,
+		ScopedCommandEnvVars: jobJson.ScopedCommandEnvVars,
 	}
 }
 
@@ -69,7 +97,9 @@ func jsonToStage(stageJson StageJson) *Stage {
 	for i, step := range stageJson.Steps {
 		steps[i] = Step{
 			Action:    step.Action,
+			Value:     step.Value,
 			ExtraArgs: step.ExtraArgs,
+			Shell:     step.Shell,
 		}
 	}
 	return &Stage{
@@ -85,7 +115,9 @@ func stageToJson(stage *Stage) StageJson {
 	for i, step := range stage.Steps {
 		steps[i] = StepJson{
 			Action:    step.Action,
+			Value:     step.Value,
 			ExtraArgs: step.ExtraArgs,
+			Shell:     step.Shell,
 		}
 	}
 	return StageJson{
@@ -1,54 +1,237 @@
 package orchestrator
 
-import configuration "github.com/diggerhq/lib-digger-config"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	configuration "github.com/diggerhq/lib-digger-config"
+)
 
 type Job struct {
-	ProjectName       string
-	ProjectDir        string
-	ProjectWorkspace  string
-	ProjectWorkflow   string
-	Terragrunt        bool
-	Commands          []string
-	ApplyStage        *Stage
-	PlanStage         *Stage
-	PullRequestNumber *int
-	EventName         string
-	RequestedBy       string
-	Namespace         string
-	StateEnvVars      map[string]string
-	CommandEnvVars    map[string]string
+	ProjectName      string `json:"projectName"`
+	ProjectDir       string `json:"projectDir"`
+	ProjectWorkspace string `json:"projectWorkspace"`
+	ProjectWorkflow  string `json:"projectWorkflow"`
+	// WorkflowHash identifies the configuration of ProjectWorkflow the job was generated from, see HashWorkflow
+	WorkflowHash string `json:"workflowHash"`
+	Terragrunt   bool   `json:"terragrunt"`
+	// DependsOn are the projects the project of the job depends on, see PruneDownstream
+	DependsOn []string `json:"dependsOn"`
+	Commands  []string `json:"commands"`
+	// Action tells whether the runner runs terraform or manipulates project locks, see JobActionForCommands
+	Action JobAction `json:"action"`
+	// CommandArgs are extra arguments of terraform plan and apply, e.g. -target flags set by TargetChangedResources or
+	// the -var-file flag of the environment of workflow_dispatch runs
+	CommandArgs []string `json:"commandArgs"`
+	// NoColor and Verbose are the global flags of the command, see ParseGlobalFlags
+	NoColor           bool              `json:"noColor"`
+	Verbose           bool              `json:"verbose"`
+	ApplyStage        *Stage            `json:"applyStage"`
+	PlanStage         *Stage            `json:"planStage"`
+	PullRequestNumber *int              `json:"pullRequestNumber"`
+	EventName         string            `json:"eventName"`
+	RequestedBy       string            `json:"requestedBy"`
+	Namespace         string            `json:"namespace"`
+	StateEnvVars      map[string]string `json:"stateEnvVars"`
+	CommandEnvVars    map[string]string `json:"commandEnvVars"`
+	// ScopedCommandEnvVars are env vars only set for one command, keyed by command name without the "digger " prefix
+	ScopedCommandEnvVars map[string]map[string]string `json:"scopedCommandEnvVars"`
+}
+
+// JobAction is what a runner does for a job: run terraform, or lock or unlock the project without running terraform
+type JobAction string
+
+const (
+	JobActionTerraform JobAction = "terraform"
+	JobActionLock      JobAction = "lock"
+	JobActionUnlock    JobAction = "unlock"
+)
+
+// CommandAction returns the action of a single command, "digger lock" and "digger unlock" manipulate locks and
+// every other command runs terraform
+func CommandAction(command string) JobAction {
+	switch strings.TrimSpace(command) {
+	case "digger lock":
+		return JobActionLock
+	case "digger unlock":
+		return JobActionUnlock
+	}
+	return JobActionTerraform
+}
+
+// JobActionForCommands returns the action shared by all commands of a job. Jobs mixing lock commands with terraform
+// ones, e.g. "digger unlock" then "digger plan", run terraform and the runner dispatches each command with
+// CommandAction.
+func JobActionForCommands(commands []string) JobAction {
+	if len(commands) == 0 {
+		return JobActionTerraform
+	}
+	action := CommandAction(commands[0])
+	for _, command := range commands[1:] {
+		if CommandAction(command) != action {
+			return JobActionTerraform
+		}
+	}
+	return action
+}
+
+// EnvVarsForCommand returns the command env vars merged with the ones scoped to command ("digger apply" or "apply"),
+// scoped values take precedence
+func (j *Job) EnvVarsForCommand(command string) map[string]string {
+	envVars := make(map[string]string)
+	for name, value := range j.CommandEnvVars {
+		envVars[name] = value
+	}
+	for name, value := range j.ScopedCommandEnvVars[strings.TrimPrefix(command, "digger ")] {
+		envVars[name] = value
+	}
+	return envVars
+}
+
+// HashWorkflow returns a SHA-256 hex digest of a workflow configuration, it changes whenever any stage, env var or
+// trigger of the workflow does, so that logs can tell which version of a workflow ran
+func HashWorkflow(workflow configuration.Workflow) string {
+	// the configuration only holds strings, slices and pointers to structs, encoding it can't fail
+	encoded, _ := json.Marshal(workflow)
+	hash := sha256.Sum256(encoded)
+	return hex.EncodeToString(hash[:])
+}
+
+// SplitCommandScopedEnvVars separates command env vars whose name is prefixed with a command, e.g.
+// "apply:TF_VAR_confirm", from the ones set for every command
+func SplitCommandScopedEnvVars(commandEnvVars map[string]string) (map[string]string, map[string]map[string]string) {
+	common := make(map[string]string)
+	scoped := make(map[string]map[string]string)
+	for name, value := range commandEnvVars {
+		command, scopedName, found := strings.Cut(name, ":")
+		if !found {
+			common[name] = value
+			continue
+		}
+		if scoped[command] == nil {
+			scoped[command] = make(map[string]string)
+		}
+		scoped[command][scopedName] = value
+	}
+	return common, scoped
+}
+
+// Validate checks that the job has everything a runner needs, returning an error naming the first missing field
+func (j *Job) Validate() error {
+	if j.ProjectName == "" {
+		return fmt.Errorf("job is missing ProjectName")
+	}
+	if j.ProjectDir == "" {
+		return fmt.Errorf("job for project %v is missing ProjectDir", j.ProjectName)
+	}
+	if len(j.Commands) == 0 {
+		return fmt.Errorf("job for project %v has no Commands", j.ProjectName)
+	}
+	if j.PlanStage == nil {
+		return fmt.Errorf("job for project %v is missing PlanStage", j.ProjectName)
+	}
+	if j.ApplyStage == nil {
+		return fmt.Errorf("job for project %v is missing ApplyStage", j.ProjectName)
+	}
+	return nil
+}
+
+func ValidateJobs(jobs []Job) error {
+	for _, job := range jobs {
+		if err := job.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeduplicateJobs drops jobs running the same commands on the same project and workspace as an earlier job
+func DeduplicateJobs(jobs []Job) []Job {
+	seen := make(map[string]bool)
+	result := make([]Job, 0, len(jobs))
+	for _, job := range jobs {
+		key := job.ProjectName + "\x00" + job.ProjectWorkspace + "\x00" + strings.Join(job.Commands, "\x00")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, job)
+	}
+	return result
+}
+
+// PruneDownstream drops the jobs of the projects depending on failedProject, directly or through the projects of other
+// jobs, so that they don't run on top of a failed upstream plan or apply. The jobs of failedProject itself are kept.
+func PruneDownstream(jobs []Job, failedProject string) []Job {
+	failed := map[string]bool{failedProject: true}
+	// dependencies may be listed in any order, iterate until no new downstream project is found
+	for changed := true; changed; {
+		changed = false
+		for _, job := range jobs {
+			if failed[job.ProjectName] {
+				continue
+			}
+			for _, dependency := range job.DependsOn {
+				if failed[dependency] {
+					failed[job.ProjectName] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	result := make([]Job, 0, len(jobs))
+	for _, job := range jobs {
+		if job.ProjectName == failedProject || !failed[job.ProjectName] {
+			result = append(result, job)
+		}
+	}
+	return result
 }
 
 type Step struct {
-	Action    string
-	Value     string
-	ExtraArgs []string
-	Shell     string
+	Action    string   `json:"action"`
+	Value     string   `json:"value"`
+	ExtraArgs []string `json:"extraArgs"`
+	Shell     string   `json:"shell"`
 }
 
 type Stage struct {
-	Steps []Step
+	Steps []Step `json:"steps"`
 }
 
-func ToConfigStep(configState configuration.Step) Step {
+func ToConfigStep(configState configuration.Step) (Step, error) {
+	if configState.Action == "" {
+		return Step{}, fmt.Errorf("step has no action")
+	}
+	if configState.Action == "run" && configState.Value == "" {
+		return Step{}, fmt.Errorf("run step has no command to run")
+	}
 	return Step{
 		Action:    configState.Action,
 		Value:     configState.Value,
 		ExtraArgs: configState.ExtraArgs,
 		Shell:     configState.Shell,
-	}
+	}, nil
 
 }
 
-func ToConfigStage(configStage *configuration.Stage) *Stage {
+func ToConfigStage(configStage *configuration.Stage) (*Stage, error) {
 	if configStage == nil {
-		return nil
+		return nil, nil
 	}
 	steps := make([]Step, 0)
-	for _, step := range configStage.Steps {
-		steps = append(steps, ToConfigStep(step))
+	for i, configStep := range configStage.Steps {
+		step, err := ToConfigStep(configStep)
+		if err != nil {
+			return nil, fmt.Errorf("invalid step %d: %v", i+1, err)
+		}
+		steps = append(steps, step)
 	}
 	return &Stage{
 		Steps: steps,
-	}
+	}, nil
 }
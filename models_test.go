@@ -0,0 +1,174 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	configuration "github.com/diggerhq/lib-digger-config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestToConfigStage(t *testing.T) {
+	stage, err := ToConfigStage(&configuration.Stage{
+		Steps: []configuration.Step{
+			{Action: "init"},
+			{Action: "run", Value: "echo hello", Shell: "bash"},
+			{Action: "plan", ExtraArgs: []string{"-refresh=false"}},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(stage.Steps))
+
+	stage, err = ToConfigStage(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, stage)
+}
+
+func TestToConfigStageInvalidStep(t *testing.T) {
+	_, err := ToConfigStage(&configuration.Stage{
+		Steps: []configuration.Step{
+			{Action: "init"},
+			{Value: "echo hello"},
+		},
+	})
+	assert.ErrorContains(t, err, "invalid step 2")
+
+	_, err = ToConfigStage(&configuration.Stage{
+		Steps: []configuration.Step{
+			{Action: "run"},
+		},
+	})
+	assert.ErrorContains(t, err, "run step has no command")
+}
+
+func TestJobJsonRoundTrip(t *testing.T) {
+	prNumber := 42
+	job := Job{
+		ProjectName:      "dev",
+		ProjectDir:       "dev",
+		ProjectWorkspace: "default",
+		ProjectWorkflow:  "default",
+		WorkflowHash:     "0123abcd",
+		Terragrunt:       true,
+		Commands:         []string{"digger plan"},
+		Action:           JobActionTerraform,
+		CommandArgs:      []string{"-target=aws_s3_bucket.logs"},
+		DependsOn:        []string{"network"},
+		NoColor:          true,
+		Verbose:          true,
+		ApplyStage: &Stage{
+			Steps: []Step{
+				{Action: "init"},
+				{Action: "apply", ExtraArgs: []string{"-auto-approve"}},
+			},
+		},
+		PlanStage: &Stage{
+			Steps: []Step{
+				{Action: "run", Value: "echo hello", Shell: "bash"},
+				{Action: "plan"},
+			},
+		},
+		PullRequestNumber: &prNumber,
+		EventName:         "pull_request",
+		RequestedBy:       "user",
+		Namespace:         "diggerhq/demo",
+		StateEnvVars:      map[string]string{"AWS_REGION": "us-east-1"},
+		CommandEnvVars:    map[string]string{"TF_LOG": "DEBUG"},
+		ScopedCommandEnvVars: map[string]map[string]string{
+			"apply": {"TF_VAR_confirm": "true"},
+		},
+	}
+
+	marshalled, err := json.Marshal(job)
+	assert.NoError(t, err)
+	assert.Contains(t, string(marshalled), `"projectName":"dev"`)
+	assert.Contains(t, string(marshalled), `"planStage":{"steps":[{"action":"run","value":"echo hello"`)
+
+	var unmarshalled Job
+	err = json.Unmarshal(marshalled, &unmarshalled)
+	assert.NoError(t, err)
+	assert.Equal(t, job, unmarshalled)
+
+	assert.Equal(t, job, JsonToJob(JobToJson(job)))
+	marshalledJobJson, err := json.Marshal(JobToJson(job))
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(marshalled), string(marshalledJobJson))
+}
+
+func TestJobValidate(t *testing.T) {
+	validJob := func() Job {
+		return Job{
+			ProjectName: "dev",
+			ProjectDir:  "dev",
+			Commands:    []string{"digger plan"},
+			PlanStage:   &Stage{},
+			ApplyStage:  &Stage{},
+		}
+	}
+
+	job := validJob()
+	assert.NoError(t, job.Validate())
+
+	job = validJob()
+	job.ProjectName = ""
+	assert.ErrorContains(t, job.Validate(), "ProjectName")
+
+	job = validJob()
+	job.ProjectDir = ""
+	assert.ErrorContains(t, job.Validate(), "ProjectDir")
+
+	job = validJob()
+	job.Commands = nil
+	assert.ErrorContains(t, job.Validate(), "Commands")
+
+	job = validJob()
+	job.PlanStage = nil
+	assert.ErrorContains(t, job.Validate(), "PlanStage")
+
+	job = validJob()
+	job.ApplyStage = nil
+	assert.ErrorContains(t, job.Validate(), "ApplyStage")
+}
+
+func TestHashWorkflow(t *testing.T) {
+	workflow := configuration.Workflow{
+		Plan: &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "plan"}}},
+	}
+	hash := HashWorkflow(workflow)
+	assert.Len(t, hash, 64)
+	assert.Equal(t, hash, HashWorkflow(workflow))
+
+	workflow.Plan = &configuration.Stage{Steps: []configuration.Step{{Action: "init"}, {Action: "plan", ExtraArgs: []string{"-refresh=false"}}}}
+	assert.NotEqual(t, hash, HashWorkflow(workflow))
+}
+
+func TestJobActionForCommands(t *testing.T) {
+	assert.Equal(t, JobActionLock, CommandAction("digger lock"))
+	assert.Equal(t, JobActionUnlock, CommandAction("digger unlock"))
+	assert.Equal(t, JobActionTerraform, CommandAction("digger plan"))
+
+	assert.Equal(t, JobActionUnlock, JobActionForCommands([]string{"digger unlock"}))
+	assert.Equal(t, JobActionLock, JobActionForCommands([]string{"digger lock", "digger lock"}))
+	assert.Equal(t, JobActionTerraform, JobActionForCommands([]string{"digger unlock", "digger plan"}))
+	assert.Equal(t, JobActionTerraform, JobActionForCommands([]string{"digger apply"}))
+}
+
+func TestPruneDownstream(t *testing.T) {
+	jobs := []Job{
+		{ProjectName: "app", DependsOn: []string{"database"}},
+		{ProjectName: "network"},
+		{ProjectName: "database", DependsOn: []string{"network"}},
+		{ProjectName: "dns"},
+	}
+
+	var names []string
+	for _, job := range PruneDownstream(jobs, "network") {
+		names = append(names, job.ProjectName)
+	}
+	assert.Equal(t, []string{"network", "dns"}, names)
+
+	names = nil
+	for _, job := range PruneDownstream(jobs, "database") {
+		names = append(names, job.ProjectName)
+	}
+	assert.Equal(t, []string{"network", "database", "dns"}, names)
+}
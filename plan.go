@@ -0,0 +1,92 @@
+package orchestrator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var ansiEscapeRegex = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+var planSummaryRegex = regexp.MustCompile(`Plan: (?:(\d+) to import, )?(\d+) to add, (\d+) to change, (\d+) to destroy\.`)
+
+var noChangesRegex = regexp.MustCompile(`No changes\.`)
+
+// StripANSI removes ANSI escape sequences, e.g. terraform colors, which GitHub renders as garbage in comments
+func StripANSI(s string) string {
+	return ansiEscapeRegex.ReplaceAllString(s, "")
+}
+
+// ParsePlanSummary returns the resource counts of the "Plan: X to add, Y to change, Z to destroy." line of terraform
+// plan output, colorized or not. Output reporting no changes yields zero counts.
+func ParsePlanSummary(planOutput string) (int, int, int, error) {
+	planOutput = StripANSI(planOutput)
+	match := planSummaryRegex.FindStringSubmatch(planOutput)
+	if match == nil {
+		if noChangesRegex.MatchString(planOutput) {
+			return 0, 0, 0, nil
+		}
+		return 0, 0, 0, fmt.Errorf("no plan summary found in output")
+	}
+	// the counts are matched as digits, Atoi only fails on overflow
+	adds, err := strconv.Atoi(match[2])
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	changes, err := strconv.Atoi(match[3])
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	destroys, err := strconv.Atoi(match[4])
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return adds, changes, destroys, nil
+}
+
+// PlanArtifact is what is kept of a plan to tell what changed when the project is planned again
+type PlanArtifact struct {
+	// Hash is the SHA-256 of the plan output without colors
+	Hash     string `json:"hash"`
+	Adds     int    `json:"adds"`
+	Changes  int    `json:"changes"`
+	Destroys int    `json:"destroys"`
+}
+
+// NewPlanArtifact returns the artifact of a plan output, which must contain a plan summary, see ParsePlanSummary
+func NewPlanArtifact(planOutput string) (PlanArtifact, error) {
+	adds, changes, destroys, err := ParsePlanSummary(planOutput)
+	if err != nil {
+		return PlanArtifact{}, err
+	}
+	hash := sha256.Sum256([]byte(StripANSI(planOutput)))
+	return PlanArtifact{Hash: hex.EncodeToString(hash[:]), Adds: adds, Changes: changes, Destroys: destroys}, nil
+}
+
+// DiffPlanSummary describes how a plan changed since the previous plan of the project, e.g.
+// "+2 to add, -1 to destroy since the last plan"
+func DiffPlanSummary(previous PlanArtifact, current PlanArtifact) string {
+	if previous.Hash == current.Hash {
+		return "no changes since the last plan"
+	}
+	var diffs []string
+	for _, count := range []struct {
+		delta int
+		verb  string
+	}{
+		{current.Adds - previous.Adds, "add"},
+		{current.Changes - previous.Changes, "change"},
+		{current.Destroys - previous.Destroys, "destroy"},
+	} {
+		if count.delta != 0 {
+			diffs = append(diffs, fmt.Sprintf("%+d to %v", count.delta, count.verb))
+		}
+	}
+	if len(diffs) == 0 {
+		return "same resource counts as the last plan, but the planned changes differ"
+	}
+	return strings.Join(diffs, ", ") + " since the last plan"
+}
@@ -0,0 +1,41 @@
+package orchestrator
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParsePlanSummary(t *testing.T) {
+	adds, changes, destroys, err := ParsePlanSummary("  # aws_s3_bucket.logs will be created\n\nPlan: 3 to add, 1 to change, 2 to destroy.\n")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{3, 1, 2}, []int{adds, changes, destroys})
+
+	adds, changes, destroys, err = ParsePlanSummary("\x1b[0m\x1b[1mPlan:\x1b[0m 1 to import, 4 to add, 0 to change, 0 to destroy.\n")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{4, 0, 0}, []int{adds, changes, destroys})
+
+	adds, changes, destroys, err = ParsePlanSummary("\x1b[32mNo changes.\x1b[0m Your infrastructure matches the configuration.")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0, 0, 0}, []int{adds, changes, destroys})
+
+	_, _, _, err = ParsePlanSummary("Error: Invalid provider configuration")
+	assert.Error(t, err)
+}
+
+func TestDiffPlanSummary(t *testing.T) {
+	previous, err := NewPlanArtifact("Plan: 1 to add, 0 to change, 1 to destroy.")
+	assert.NoError(t, err)
+	colored, err := NewPlanArtifact("\x1b[1mPlan:\x1b[0m 1 to add, 0 to change, 1 to destroy.")
+	assert.NoError(t, err)
+	current, err := NewPlanArtifact("  # aws_s3_bucket.logs will be created\nPlan: 3 to add, 0 to change, 0 to destroy.")
+	assert.NoError(t, err)
+	reordered, err := NewPlanArtifact("  # aws_s3_bucket.data will be created\nPlan: 1 to add, 0 to change, 1 to destroy.")
+	assert.NoError(t, err)
+
+	assert.Equal(t, "no changes since the last plan", DiffPlanSummary(previous, colored))
+	assert.Equal(t, "+2 to add, -1 to destroy since the last plan", DiffPlanSummary(previous, current))
+	assert.Equal(t, "same resource counts as the last plan, but the planned changes differ", DiffPlanSummary(previous, reordered))
+
+	_, err = NewPlanArtifact("Error: invalid configuration")
+	assert.Error(t, err)
+}
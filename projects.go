@@ -0,0 +1,160 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	configuration "github.com/diggerhq/lib-digger-config"
+)
+
+var ErrProjectNotImpacted = errors.New("project not impacted")
+
+// ErrNoProjectsImpacted is returned for commands on pull requests which don't change any project, consumers can
+// reply that no terraform changes were detected
+var ErrNoProjectsImpacted = errors.New("no projects impacted")
+
+// ProjectSelectionStrategy decides which projects run when the directories of impacted projects are nested,
+// e.g. projects at infra and infra/app both match a change to infra/app/main.tf
+type ProjectSelectionStrategy int
+
+const (
+	// SelectAllProjects runs every impacted project, nested or not
+	SelectAllProjects ProjectSelectionStrategy = iota
+	// SelectMostSpecificProject attributes each changed file to the impacted projects with the deepest directory
+	// containing it and drops projects left without files, unless a changed file outside their directory matches
+	// their include patterns.
+	SelectMostSpecificProject
+)
+
+func SelectProjects(impactedProjects []configuration.Project, changedFiles []string, strategy ProjectSelectionStrategy) []configuration.Project {
+	if strategy != SelectMostSpecificProject {
+		return impactedProjects
+	}
+
+	owners := make(map[string]bool)
+	for _, file := range changedFiles {
+		// several projects can share the deepest directory, e.g. one project per workspace
+		var fileOwners []string
+		ownerDepth := -1
+		for _, project := range impactedProjects {
+			dir := cleanProjectDir(project.Dir)
+			if !isFileInDir(file, dir) {
+				continue
+			}
+			depth := dirDepth(dir)
+			if depth > ownerDepth {
+				fileOwners = fileOwners[:0]
+				ownerDepth = depth
+			}
+			if depth == ownerDepth {
+				fileOwners = append(fileOwners, project.Name)
+			}
+		}
+		for _, owner := range fileOwners {
+			owners[owner] = true
+		}
+	}
+
+	selected := make([]configuration.Project, 0, len(impactedProjects))
+	for _, project := range impactedProjects {
+		if owners[project.Name] || matchesIncludePatternsOutsideDir(project, changedFiles) {
+			selected = append(selected, project)
+		}
+	}
+	return selected
+}
+
+func matchesIncludePatternsOutsideDir(project configuration.Project, changedFiles []string) bool {
+	if len(project.IncludePatterns) == 0 {
+		return false
+	}
+	dir := cleanProjectDir(project.Dir)
+	for _, file := range changedFiles {
+		if isFileInDir(file, dir) {
+			continue
+		}
+		// the matcher normalizes patterns in place, don't let it touch the project's own slices
+		includePatterns := append([]string{}, project.IncludePatterns...)
+		excludePatterns := append([]string{}, project.ExcludePatterns...)
+		if configuration.MatchIncludeExcludePatternsToFile(file, includePatterns, excludePatterns) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveProjectGroup returns the projects of group, looked up by name in groups (group name to project names) or,
+// when no such group is defined, the projects located in the group directory
+func ResolveProjectGroup(group string, projects []configuration.Project, groups map[string][]string) ([]configuration.Project, error) {
+	var result []configuration.Project
+	if projectNames, ok := groups[group]; ok {
+		for _, projectName := range projectNames {
+			found := false
+			for _, project := range projects {
+				if project.Name == projectName {
+					result = append(result, project)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("project %v of group %v not found", projectName, group)
+			}
+		}
+	} else {
+		dir := cleanProjectDir(group)
+		for _, project := range projects {
+			projectDir := cleanProjectDir(project.Dir)
+			if projectDir == dir || isFileInDir(projectDir, dir) {
+				result = append(result, project)
+			}
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("project group %v is unknown or empty", group)
+	}
+	return result, nil
+}
+
+// FilterProjectsByTags keeps the projects tagged with any of tags, or all of them when matchAll is set. projectTags
+// maps project names to their tags.
+func FilterProjectsByTags(projects []configuration.Project, projectTags map[string][]string, tags []string, matchAll bool) []configuration.Project {
+	result := make([]configuration.Project, 0)
+	for _, project := range projects {
+		projectTagSet := make(map[string]bool)
+		for _, tag := range projectTags[project.Name] {
+			projectTagSet[tag] = true
+		}
+		matched := 0
+		for _, tag := range tags {
+			if projectTagSet[tag] {
+				matched++
+			}
+		}
+		if (matchAll && matched == len(tags)) || (!matchAll && matched > 0) {
+			result = append(result, project)
+		}
+	}
+	return result
+}
+
+func cleanProjectDir(dir string) string {
+	return strings.TrimPrefix(path.Clean("/"+dir), "/")
+}
+
+func isFileInDir(file string, dir string) bool {
+	if dir == "" {
+		return true
+	}
+	file = strings.TrimPrefix(path.Clean("/"+file), "/")
+	return strings.HasPrefix(file, dir+"/")
+}
+
+func dirDepth(dir string) int {
+	if dir == "" {
+		return 0
+	}
+	return strings.Count(dir, "/") + 1
+}
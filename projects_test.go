@@ -0,0 +1,106 @@
+package orchestrator
+
+import (
+	configuration "github.com/diggerhq/lib-digger-config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func projectNames(projects []configuration.Project) []string {
+	names := make([]string, 0, len(projects))
+	for _, project := range projects {
+		names = append(names, project.Name)
+	}
+	return names
+}
+
+func TestSelectProjectsNestedDirs(t *testing.T) {
+	impactedProjects := []configuration.Project{
+		{
+			Name: "infra",
+			Dir:  "/infra",
+		},
+		{
+			Name: "app",
+			Dir:  "/infra/app",
+		},
+	}
+
+	changedFiles := []string{"infra/app/main.tf"}
+	assert.Equal(t, []string{"infra", "app"}, projectNames(SelectProjects(impactedProjects, changedFiles, SelectAllProjects)))
+	assert.Equal(t, []string{"app"}, projectNames(SelectProjects(impactedProjects, changedFiles, SelectMostSpecificProject)))
+
+	changedFiles = []string{"infra/app/main.tf", "infra/main.tf"}
+	assert.Equal(t, []string{"infra", "app"}, projectNames(SelectProjects(impactedProjects, changedFiles, SelectMostSpecificProject)))
+}
+
+func TestSelectProjectsSameDirWorkspaces(t *testing.T) {
+	impactedProjects := []configuration.Project{
+		{Name: "infra", Dir: "infra"},
+		{Name: "app-dev", Dir: "infra/app", Workspace: "dev"},
+		{Name: "app-prod", Dir: "infra/app", Workspace: "prod"},
+	}
+
+	changedFiles := []string{"infra/app/main.tf"}
+	assert.Equal(t, []string{"app-dev", "app-prod"}, projectNames(SelectProjects(impactedProjects, changedFiles, SelectMostSpecificProject)))
+}
+
+func TestSelectProjectsKeepsIncludePatternMatches(t *testing.T) {
+	impactedProjects := []configuration.Project{
+		{
+			Name:            "infra",
+			Dir:             "infra",
+			IncludePatterns: []string{"modules/**"},
+		},
+		{
+			Name: "app",
+			Dir:  "infra/app",
+		},
+	}
+
+	changedFiles := []string{"infra/app/main.tf", "modules/vpc/main.tf"}
+	assert.Equal(t, []string{"infra", "app"}, projectNames(SelectProjects(impactedProjects, changedFiles, SelectMostSpecificProject)))
+}
+
+func TestResolveProjectGroup(t *testing.T) {
+	projects := []configuration.Project{
+		{Name: "vpc", Dir: "networking/vpc"},
+		{Name: "dns", Dir: "networking/dns"},
+		{Name: "app", Dir: "app"},
+	}
+	groups := map[string][]string{
+		"core": {"vpc", "app"},
+	}
+
+	resolved, err := ResolveProjectGroup("core", projects, groups)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"vpc", "app"}, projectNames(resolved))
+
+	resolved, err = ResolveProjectGroup("networking", projects, groups)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"vpc", "dns"}, projectNames(resolved))
+
+	_, err = ResolveProjectGroup("unknown", projects, groups)
+	assert.Error(t, err)
+
+	_, err = ResolveProjectGroup("empty", projects, map[string][]string{"empty": {}})
+	assert.Error(t, err)
+}
+
+func TestFilterProjectsByTags(t *testing.T) {
+	projects := []configuration.Project{
+		{Name: "prod-eu"},
+		{Name: "prod-us"},
+		{Name: "dev-eu"},
+	}
+	projectTags := map[string][]string{
+		"prod-eu": {"prod", "eu"},
+		"prod-us": {"prod", "us"},
+		"dev-eu":  {"dev", "eu"},
+	}
+
+	assert.Equal(t, []string{"prod-eu", "prod-us"}, projectNames(FilterProjectsByTags(projects, projectTags, []string{"prod"}, false)))
+	assert.Equal(t, []string{"prod-eu", "prod-us", "dev-eu"}, projectNames(FilterProjectsByTags(projects, projectTags, []string{"prod", "eu"}, false)))
+	assert.Equal(t, []string{"prod-eu"}, projectNames(FilterProjectsByTags(projects, projectTags, []string{"prod", "eu"}, true)))
+	assert.Empty(t, FilterProjectsByTags(projects, projectTags, []string{"staging"}, false))
+}
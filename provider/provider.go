@@ -0,0 +1,41 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	orchestrator "github.com/diggerhq/lib-orchestrator"
+	"github.com/diggerhq/lib-orchestrator/github"
+)
+
+var ErrUnsupportedProvider = errors.New("unsupported CI provider")
+
+const GitHub = "github"
+
+// ServiceConfig configures the service created by NewPullRequestService, fields that don't apply to the provider are
+// ignored
+type ServiceConfig struct {
+	// Token authenticates API requests. GitHub: a personal access token or GitHub App installation token.
+	Token string
+	// Owner is the owner of the repository. GitHub: the user or organisation login.
+	Owner string
+	// RepoName is the name of the repository, without the owner
+	RepoName string
+	// GitHub configures caching, token refreshing and the transport of GitHub services
+	GitHub github.ServiceOptions
+}
+
+// NewPullRequestService creates the PullRequestService of provider, e.g. "github", so that consumers don't depend on a
+// specific CI provider. Unknown providers return ErrUnsupportedProvider.
+func NewPullRequestService(provider string, cfg ServiceConfig) (orchestrator.PullRequestService, error) {
+	switch strings.ToLower(provider) {
+	case GitHub:
+		svc, err := github.NewGitHubServiceWithOptions(cfg.Token, cfg.RepoName, cfg.Owner, cfg.GitHub)
+		if err != nil {
+			return nil, err
+		}
+		return &svc, nil
+	}
+	return nil, fmt.Errorf("%w: %v", ErrUnsupportedProvider, provider)
+}
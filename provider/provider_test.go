@@ -0,0 +1,23 @@
+package provider
+
+import (
+	"github.com/diggerhq/lib-orchestrator/github"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewPullRequestService(t *testing.T) {
+	svc, err := NewPullRequestService("GitHub", ServiceConfig{Token: "token", Owner: "diggerhq", RepoName: "demo"})
+	assert.NoError(t, err)
+	if assert.IsType(t, &github.GithubService{}, svc) {
+		githubService := svc.(*github.GithubService)
+		assert.Equal(t, "diggerhq", githubService.Owner)
+		assert.Equal(t, "demo", githubService.RepoName)
+	}
+
+	_, err = NewPullRequestService("github", ServiceConfig{Owner: "diggerhq", RepoName: "demo"})
+	assert.ErrorContains(t, err, "github token is empty")
+
+	_, err = NewPullRequestService("bitbucket", ServiceConfig{Token: "token", Owner: "diggerhq", RepoName: "demo"})
+	assert.ErrorIs(t, err, ErrUnsupportedProvider)
+}
@@ -0,0 +1,94 @@
+package orchestrator
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// PlanSummary counts the resource changes of a terraform plan
+type PlanSummary struct {
+	ResourcesToAdd     int
+	ResourcesToChange  int
+	ResourcesToDestroy int
+}
+
+// JobResult is the outcome of running a command for a project
+type JobResult struct {
+	Project string
+	Command string
+	Status  JobStatus
+	// PlanSummary is nil when the command didn't produce a plan
+	PlanSummary *PlanSummary
+	Error       error
+}
+
+// FormatJobResults renders job results as a markdown table, suitable for a pull request comment
+func FormatJobResults(results []JobResult) string {
+	var sb strings.Builder
+	sb.WriteString("| Project | Command | Status | Add | Change | Destroy |\n")
+	sb.WriteString("|---------|---------|--------|-----|--------|---------|\n")
+	for _, result := range results {
+		status := result.Status.Description()
+		if result.Error != nil {
+			status = fmt.Sprintf("%v: %v", status, result.Error)
+		}
+		add, change, destroy := "-", "-", "-"
+		if result.PlanSummary != nil {
+			add = fmt.Sprint(result.PlanSummary.ResourcesToAdd)
+			change = fmt.Sprint(result.PlanSummary.ResourcesToChange)
+			destroy = fmt.Sprint(result.PlanSummary.ResourcesToDestroy)
+		}
+		fmt.Fprintf(&sb, "| %v | %v | %v | %v | %v | %v |\n",
+			escapeTableCell(result.Project), escapeTableCell(result.Command), escapeTableCell(status), add, change, destroy)
+	}
+	return sb.String()
+}
+
+// FormatStepSummary renders job results for the summary of a GitHub Actions run, written by runners to the file
+// $GITHUB_STEP_SUMMARY points to: the FormatJobResults table followed by a collapsible section per project
+func FormatStepSummary(results []JobResult) string {
+	var sb strings.Builder
+	sb.WriteString("## Digger results\n\n")
+	sb.WriteString(FormatJobResults(results))
+	for _, result := range results {
+		fmt.Fprintf(&sb, "\n<details>\n<summary><b>%v</b> %v: %v</summary>\n\n",
+			html.EscapeString(result.Project), html.EscapeString(strings.TrimSpace(result.Command)), result.Status.Description())
+		if result.PlanSummary != nil {
+			fmt.Fprintf(&sb, "Plan: %d to add, %d to change, %d to destroy.\n\n",
+				result.PlanSummary.ResourcesToAdd, result.PlanSummary.ResourcesToChange, result.PlanSummary.ResourcesToDestroy)
+		}
+		if result.Error != nil {
+			fmt.Fprintf(&sb, "```\n%v\n```\n\n", strings.TrimRight(result.Error.Error(), "\n"))
+		}
+		if result.PlanSummary == nil && result.Error == nil {
+			sb.WriteString("No details.\n\n")
+		}
+		sb.WriteString("</details>\n")
+	}
+	return sb.String()
+}
+
+// AggregateState combines job results into a commit state: "failure" when any job failed, "pending" when any job is
+// still running, "success" otherwise
+func AggregateState(results []JobResult) string {
+	state := "success"
+	for _, result := range results {
+		if result.Error != nil {
+			return "failure"
+		}
+		switch result.Status.CommitState() {
+		case "failure", "error":
+			return "failure"
+		case "pending":
+			state = "pending"
+		}
+	}
+	return state
+}
+
+// escapeTableCell keeps a value on a single markdown table cell
+func escapeTableCell(value string) string {
+	value = strings.ReplaceAll(value, "|", "\\|")
+	return strings.Join(strings.Fields(value), " ")
+}
@@ -0,0 +1,73 @@
+package orchestrator
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFormatJobResults(t *testing.T) {
+	results := []JobResult{
+		{
+			Project:     "dev",
+			Command:     "digger plan",
+			Status:      PlanSucceeded,
+			PlanSummary: &PlanSummary{ResourcesToAdd: 2, ResourcesToChange: 1},
+		},
+		{
+			Project: "prod",
+			Command: "digger apply",
+			Status:  ApplyFailed,
+			Error:   errors.New("state lock | held\nby another run"),
+		},
+	}
+
+	expected := "| Project | Command | Status | Add | Change | Destroy |\n" +
+		"|---------|---------|--------|-----|--------|---------|\n" +
+		"| dev | digger plan | Plan succeeded | 2 | 1 | 0 |\n" +
+		"| prod | digger apply | Apply failed: state lock \\| held by another run | - | - | - |\n"
+	assert.Equal(t, expected, FormatJobResults(results))
+}
+
+func TestFormatStepSummary(t *testing.T) {
+	results := []JobResult{
+		{
+			Project:     "dev",
+			Command:     "digger plan",
+			Status:      PlanSucceeded,
+			PlanSummary: &PlanSummary{ResourcesToAdd: 2, ResourcesToChange: 1},
+		},
+		{
+			Project: "prod<1>",
+			Command: "digger apply",
+			Status:  ApplyFailed,
+			Error:   errors.New("state lock held by another run\n"),
+		},
+		{
+			Project: "staging",
+			Command: "digger unlock",
+			Status:  ApplySucceeded,
+		},
+	}
+
+	expected := "## Digger results\n\n" +
+		FormatJobResults(results) +
+		"\n<details>\n<summary><b>dev</b> digger plan: Plan succeeded</summary>\n\n" +
+		"Plan: 2 to add, 1 to change, 0 to destroy.\n\n" +
+		"</details>\n" +
+		"\n<details>\n<summary><b>prod&lt;1&gt;</b> digger apply: Apply failed</summary>\n\n" +
+		"```\nstate lock held by another run\n```\n\n" +
+		"</details>\n" +
+		"\n<details>\n<summary><b>staging</b> digger unlock: Apply succeeded</summary>\n\n" +
+		"No details.\n\n" +
+		"</details>\n"
+	assert.Equal(t, expected, FormatStepSummary(results))
+}
+
+func TestAggregateState(t *testing.T) {
+	assert.Equal(t, "success", AggregateState(nil))
+	assert.Equal(t, "success", AggregateState([]JobResult{{Status: PlanSucceeded}, {Status: ApplySucceeded}}))
+	assert.Equal(t, "pending", AggregateState([]JobResult{{Status: PlanSucceeded}, {Status: PlanPending}}))
+	assert.Equal(t, "failure", AggregateState([]JobResult{{Status: PlanPending}, {Status: ApplyFailed}, {Status: PlanSucceeded}}))
+	assert.Equal(t, "failure", AggregateState([]JobResult{{Status: PlanSucceeded, Error: errors.New("state lock held")}}))
+}
@@ -0,0 +1,70 @@
+package orchestrator
+
+import (
+	"sort"
+	"strings"
+)
+
+// SensitiveEnvVarKeys are matched case-insensitively against the names of env vars, the values of env vars whose name
+// contains one of them are secrets that must not be logged. Consumers may add their own keys.
+var SensitiveEnvVarKeys = []string{"TOKEN", "SECRET", "PASSWORD", "PASSWD", "KEY", "CREDENTIAL", "AUTH", "PRIVATE", "CERT"}
+
+const maskedValue = "***"
+
+// IsSensitiveEnvVar tells whether the value of the env var name is a secret, see SensitiveEnvVarKeys
+func IsSensitiveEnvVar(name string) bool {
+	name = strings.ToUpper(name)
+	for _, key := range SensitiveEnvVarKeys {
+		if strings.Contains(name, strings.ToUpper(key)) {
+			return true
+		}
+	}
+	return false
+}
+
+// MaskSecrets returns a copy of envVars where the values of sensitive env vars are replaced with "***", env vars,
+// e.g. the state and command env vars of jobs, must only be logged or put in errors masked
+func MaskSecrets(envVars map[string]string) map[string]string {
+	if envVars == nil {
+		return nil
+	}
+	masked := make(map[string]string, len(envVars))
+	for name, value := range envVars {
+		if IsSensitiveEnvVar(name) && value != "" {
+			value = maskedValue
+		}
+		masked[name] = value
+	}
+	return masked
+}
+
+// RedactSecretValues replaces the values of the sensitive env vars of envVars found in text, e.g. command output or
+// an error message, with "***"
+func RedactSecretValues(text string, envVars map[string]string) string {
+	var secrets []string
+	for name, value := range envVars {
+		if IsSensitiveEnvVar(name) && value != "" {
+			secrets = append(secrets, value)
+		}
+	}
+	// longer values first so that a secret containing another one is redacted whole
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+	for _, secret := range secrets {
+		text = strings.ReplaceAll(text, secret, maskedValue)
+	}
+	return text
+}
+
+// Redacted returns a copy of the job whose env vars are masked with MaskSecrets, for logging jobs
+func (j *Job) Redacted() Job {
+	redacted := *j
+	redacted.StateEnvVars = MaskSecrets(j.StateEnvVars)
+	redacted.CommandEnvVars = MaskSecrets(j.CommandEnvVars)
+	if j.ScopedCommandEnvVars != nil {
+		redacted.ScopedCommandEnvVars = make(map[string]map[string]string, len(j.ScopedCommandEnvVars))
+		for command, envVars := range j.ScopedCommandEnvVars {
+			redacted.ScopedCommandEnvVars[command] = MaskSecrets(envVars)
+		}
+	}
+	return redacted
+}
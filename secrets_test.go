@@ -0,0 +1,44 @@
+package orchestrator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaskSecrets(t *testing.T) {
+	envVars := map[string]string{
+		"AWS_SECRET_ACCESS_KEY": "wJalrXUtnFEMI",
+		"github_token":          "ghp_123",
+		"TF_VAR_region":         "eu-west-1",
+		"DB_PASSWORD":           "",
+	}
+	assert.Equal(t, map[string]string{
+		"AWS_SECRET_ACCESS_KEY": "***",
+		"github_token":          "***",
+		"TF_VAR_region":         "eu-west-1",
+		"DB_PASSWORD":           "",
+	}, MaskSecrets(envVars))
+	assert.Equal(t, "wJalrXUtnFEMI", envVars["AWS_SECRET_ACCESS_KEY"])
+	assert.Nil(t, MaskSecrets(nil))
+}
+
+func TestRedactSecretValues(t *testing.T) {
+	envVars := map[string]string{"API_TOKEN": "abc123", "TF_VAR_name": "abc"}
+	assert.Equal(t, "curl -H 'Authorization: ***' abc", RedactSecretValues("curl -H 'Authorization: abc123' abc", envVars))
+}
+
+func TestJobRedacted(t *testing.T) {
+	job := Job{
+		ProjectName:          "dev",
+		StateEnvVars:         map[string]string{"AWS_ACCESS_KEY_ID": "AKIA"},
+		CommandEnvVars:       map[string]string{"TF_LOG": "debug"},
+		ScopedCommandEnvVars: map[string]map[string]string{"apply": {"VAULT_TOKEN": "s.123"}},
+	}
+	redacted := job.Redacted()
+	assert.Equal(t, "***", redacted.StateEnvVars["AWS_ACCESS_KEY_ID"])
+	assert.Equal(t, "debug", redacted.CommandEnvVars["TF_LOG"])
+	assert.Equal(t, "***", redacted.ScopedCommandEnvVars["apply"]["VAULT_TOKEN"])
+	assert.Equal(t, "AKIA", job.StateEnvVars["AWS_ACCESS_KEY_ID"])
+	assert.Equal(t, "s.123", job.ScopedCommandEnvVars["apply"]["VAULT_TOKEN"])
+}
@@ -0,0 +1,56 @@
+package orchestrator
+
+import (
+	"fmt"
+	"strings"
+)
+
+type JobStatus int
+
+const (
+	PlanPending JobStatus = iota
+	PlanSucceeded
+	PlanFailed
+	ApplyPending
+	ApplySucceeded
+	ApplyFailed
+)
+
+// CommitState maps a job status to the commit status vocabulary understood by the CI provider: "pending", "success", "failure"
+func (s JobStatus) CommitState() string {
+	switch s {
+	case PlanPending, ApplyPending:
+		return "pending"
+	case PlanSucceeded, ApplySucceeded:
+		return "success"
+	case PlanFailed, ApplyFailed:
+		return "failure"
+	}
+	return "error"
+}
+
+func (s JobStatus) Description() string {
+	switch s {
+	case PlanPending:
+		return "Plan in progress"
+	case PlanSucceeded:
+		return "Plan succeeded"
+	case PlanFailed:
+		return "Plan failed"
+	case ApplyPending:
+		return "Apply in progress"
+	case ApplySucceeded:
+		return "Apply succeeded"
+	case ApplyFailed:
+		return "Apply failed"
+	}
+	return fmt.Sprintf("Unknown job status %d", int(s))
+}
+
+// StatusContext returns the status context of a command run for a project, following the "digger/<command>/<project>"
+// convention, e.g. "digger/plan/networking". Branch protection rules can require these predictable names. The
+// "digger " prefix of commands is dropped, "digger plan" and "plan" give the same context.
+func StatusContext(command string, project string) string {
+	command = strings.TrimPrefix(strings.TrimSpace(command), "digger ")
+	return fmt.Sprintf("digger/%v/%v", command, project)
+}
@@ -0,0 +1,31 @@
+package orchestrator
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestStatusContext(t *testing.T) {
+	assert.Equal(t, "digger/plan/networking", StatusContext("plan", "networking"))
+	assert.Equal(t, "digger/apply/networking", StatusContext("digger apply", "networking"))
+}
+
+func TestJobStatusMapping(t *testing.T) {
+	tests := []struct {
+		status      JobStatus
+		commitState string
+		description string
+	}{
+		{PlanPending, "pending", "Plan in progress"},
+		{PlanSucceeded, "success", "Plan succeeded"},
+		{PlanFailed, "failure", "Plan failed"},
+		{ApplyPending, "pending", "Apply in progress"},
+		{ApplySucceeded, "success", "Apply succeeded"},
+		{ApplyFailed, "failure", "Apply failed"},
+		{JobStatus(42), "error", "Unknown job status 42"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.commitState, test.status.CommitState())
+		assert.Equal(t, test.description, test.status.Description())
+	}
+}
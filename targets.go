@@ -0,0 +1,70 @@
+package orchestrator
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+)
+
+// terraformBlockRegexp matches the top-level blocks of a terraform configuration, with their labels
+var terraformBlockRegexp = regexp.MustCompile(`(?m)^\s*(resource|data|module|variable|locals|output|provider|terraform|moved|import|removed|check)\b(?:\s+"([^"]+)")?(?:\s+"([^"]+)")?\s*\{`)
+
+// TargetChangedResources is an opt-in limiting the plans of jobs to the resources declared in the changed files of
+// their project, with -target flags set in CommandArgs. It is a best-effort heuristic:
+//   - every resource, data source and module declared in a changed .tf file is targeted, not only the changed blocks
+//   - nothing is targeted, i.e. the whole project is planned, as soon as a changed file of the project isn't a .tf
+//     file (tfvars, lock files, ...), can't be read (e.g. it was deleted) or declares blocks affecting the whole
+//     configuration (variables, locals, outputs, providers, terraform settings, moved and import blocks)
+//   - resources depending on the targeted ones are not planned, and terragrunt projects are never targeted
+//
+// Terraform itself warns that targeting is meant for exceptional situations, the applied state can diverge from the
+// configuration until a full plan is applied.
+func TargetChangedResources(workingDir string, jobs []Job, changedFiles []string) {
+	for i := range jobs {
+		if jobs[i].Terragrunt {
+			continue
+		}
+		targets := targetAddresses(workingDir, jobs[i].ProjectDir, changedFiles)
+		for _, target := range targets {
+			jobs[i].CommandArgs = append(jobs[i].CommandArgs, "-target="+target)
+		}
+	}
+}
+
+// targetAddresses returns the addresses declared in the changed files of the project in projectDir, or nil when the
+// project can't be targeted
+func targetAddresses(workingDir string, projectDir string, changedFiles []string) []string {
+	dir := cleanProjectDir(NormalizePath(projectDir))
+	var targets []string
+	for _, file := range changedFiles {
+		file = cleanProjectDir(NormalizePath(file))
+		if !isFileInDir(file, dir) {
+			continue
+		}
+		// files in subdirectories, e.g. local modules, can't be mapped to the blocks using them
+		if cleanProjectDir(path.Dir(file)) != dir {
+			return nil
+		}
+		if path.Ext(file) != ".tf" {
+			return nil
+		}
+		content, err := os.ReadFile(filepath.Join(workingDir, filepath.FromSlash(file)))
+		if err != nil {
+			return nil
+		}
+		for _, match := range terraformBlockRegexp.FindAllStringSubmatch(string(content), -1) {
+			switch match[1] {
+			case "resource":
+				targets = append(targets, match[2]+"."+match[3])
+			case "data":
+				targets = append(targets, "data."+match[2]+"."+match[3])
+			case "module":
+				targets = append(targets, "module."+match[2])
+			default:
+				return nil
+			}
+		}
+	}
+	return targets
+}
@@ -0,0 +1,52 @@
+package orchestrator
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTargetChangedResources(t *testing.T) {
+	workingDir := t.TempDir()
+	files := map[string]string{
+		"dev/s3.tf": `resource "aws_s3_bucket" "logs" {
+  bucket   = "logs"
+  provider = aws.west
+}
+
+data "aws_iam_policy_document" "logs" {
+  statement {}
+}
+`,
+		"dev/network.tf":   `module "vpc" { source = "./modules/vpc" }`,
+		"dev/variables.tf": `variable "region" {}`,
+	}
+	for file, content := range files {
+		assert.NoError(t, os.MkdirAll(filepath.Join(workingDir, filepath.Dir(file)), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(workingDir, file), []byte(content), 0644))
+	}
+	newJobs := func() []Job {
+		return []Job{{ProjectName: "dev", ProjectDir: "dev"}, {ProjectName: "prod", ProjectDir: "prod"}}
+	}
+
+	jobs := newJobs()
+	TargetChangedResources(workingDir, jobs, []string{"dev/s3.tf", "dev/network.tf", "prod/main.tf"})
+	assert.Equal(t, []string{"-target=aws_s3_bucket.logs", "-target=data.aws_iam_policy_document.logs", "-target=module.vpc"}, jobs[0].CommandArgs)
+	// prod/main.tf can't be read
+	assert.Empty(t, jobs[1].CommandArgs)
+
+	for _, changedFiles := range [][]string{
+		{"dev/s3.tf", "dev/variables.tf"},
+		{"dev/s3.tf", "dev/terraform.tfvars"},
+		{"dev/s3.tf", "dev/modules/vpc/main.tf"},
+	} {
+		jobs = newJobs()
+		TargetChangedResources(workingDir, jobs, changedFiles)
+		assert.Empty(t, jobs[0].CommandArgs, changedFiles)
+	}
+
+	jobs = []Job{{ProjectName: "dev", ProjectDir: "dev", Terragrunt: true}}
+	TargetChangedResources(workingDir, jobs, []string{"dev/s3.tf"})
+	assert.Empty(t, jobs[0].CommandArgs)
+}
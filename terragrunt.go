@@ -0,0 +1,83 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+
+	configuration "github.com/diggerhq/lib-digger-config"
+)
+
+const terragruntConfigurationFileName = "terragrunt.hcl"
+
+var (
+	terragruntConfigPathRegexp   = regexp.MustCompile(`config_path\s*=\s*"([^"]+)"`)
+	terragruntDependenciesRegexp = regexp.MustCompile(`(?s)dependencies\s*\{.*?paths\s*=\s*\[([^\]]*)\]`)
+	terragruntQuotedStringRegexp = regexp.MustCompile(`"([^"]+)"`)
+)
+
+// ExpandTerragruntDependents adds to impactedProjects the terragrunt projects depending on them, directly or
+// transitively, as "terragrunt run-all" would. Dependencies are read from the dependency and dependencies blocks of
+// the terragrunt.hcl file of each terragrunt project under workingDir, only literal paths are understood.
+func ExpandTerragruntDependents(workingDir string, projects []configuration.Project, impactedProjects []configuration.Project) ([]configuration.Project, error) {
+	// dependents maps project directories to the terragrunt projects depending on them
+	dependents := make(map[string][]configuration.Project)
+	for _, project := range projects {
+		if !project.Terragrunt {
+			continue
+		}
+		dependencyDirs, err := terragruntDependencyDirs(workingDir, project.Dir)
+		if err != nil {
+			return nil, fmt.Errorf("error reading terragrunt dependencies of project %v: %v", project.Name, err)
+		}
+		for _, dependencyDir := range dependencyDirs {
+			dependents[dependencyDir] = append(dependents[dependencyDir], project)
+		}
+	}
+
+	result := make([]configuration.Project, 0, len(impactedProjects))
+	seen := make(map[string]bool)
+	queue := append([]configuration.Project{}, impactedProjects...)
+	for len(queue) > 0 {
+		project := queue[0]
+		queue = queue[1:]
+		if seen[project.Name] {
+			continue
+		}
+		seen[project.Name] = true
+		result = append(result, project)
+		queue = append(queue, dependents[cleanProjectDir(project.Dir)]...)
+	}
+	return result, nil
+}
+
+// terragruntDependencyDirs returns the directories, relative to workingDir, of the units the terragrunt unit in
+// projectDir depends on. Units without a terragrunt.hcl file have no dependencies.
+func terragruntDependencyDirs(workingDir string, projectDir string) ([]string, error) {
+	content, err := os.ReadFile(filepath.Join(workingDir, filepath.FromSlash(projectDir), terragruntConfigurationFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var dependencyPaths []string
+	for _, match := range terragruntConfigPathRegexp.FindAllStringSubmatch(string(content), -1) {
+		dependencyPaths = append(dependencyPaths, match[1])
+	}
+	for _, match := range terragruntDependenciesRegexp.FindAllStringSubmatch(string(content), -1) {
+		for _, quoted := range terragruntQuotedStringRegexp.FindAllStringSubmatch(match[1], -1) {
+			dependencyPaths = append(dependencyPaths, quoted[1])
+		}
+	}
+
+	dirs := make([]string, 0, len(dependencyPaths))
+	for _, dependencyPath := range dependencyPaths {
+		dirs = append(dirs, cleanProjectDir(path.Join(NormalizePath(projectDir), NormalizePath(dependencyPath))))
+	}
+	return dirs, nil
+}
@@ -0,0 +1,45 @@
+package orchestrator
+
+import (
+	configuration "github.com/diggerhq/lib-digger-config"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTerragruntConfig(t *testing.T, workingDir string, dir string, content string) {
+	assert.NoError(t, os.MkdirAll(filepath.Join(workingDir, dir), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(workingDir, dir, "terragrunt.hcl"), []byte(content), 0644))
+}
+
+func TestExpandTerragruntDependents(t *testing.T) {
+	workingDir := t.TempDir()
+	writeTerragruntConfig(t, workingDir, "live/vpc", `terraform { source = "../../modules/vpc" }`)
+	writeTerragruntConfig(t, workingDir, "live/db", `
+dependency "vpc" {
+  config_path = "../vpc"
+}
+`)
+	writeTerragruntConfig(t, workingDir, "live/app", `
+dependencies {
+  paths = ["../db"]
+}
+`)
+	writeTerragruntConfig(t, workingDir, "live/dns", `dependency "app" { config_path = "../app" }`)
+
+	vpc := configuration.Project{Name: "vpc", Dir: "live/vpc", Terragrunt: true}
+	db := configuration.Project{Name: "db", Dir: "live/db", Terragrunt: true}
+	app := configuration.Project{Name: "app", Dir: "./live/app", Terragrunt: true}
+	dns := configuration.Project{Name: "dns", Dir: "live/dns", Terragrunt: true}
+	plain := configuration.Project{Name: "plain", Dir: "plain"}
+	projects := []configuration.Project{vpc, db, app, dns, plain}
+
+	impacted, err := ExpandTerragruntDependents(workingDir, projects, []configuration.Project{vpc})
+	assert.NoError(t, err)
+	assert.Equal(t, []configuration.Project{vpc, db, app, dns}, impacted)
+
+	impacted, err = ExpandTerragruntDependents(workingDir, projects, []configuration.Project{app, plain})
+	assert.NoError(t, err)
+	assert.Equal(t, []configuration.Project{app, plain, dns}, impacted)
+}
@@ -1,10 +1,44 @@
 package orchestrator
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"regexp"
+	"strings"
 )
 
+// NormalizePath converts Windows-style separators to forward slashes, the separator used by the CI providers and
+// project patterns regardless of the platform digger runs on
+func NormalizePath(path string) string {
+	return strings.ReplaceAll(path, "\\", "/")
+}
+
+var inlineCodeRegexp = regexp.MustCompile("`[^`\n]*`")
+
+// StripCode removes the fenced code blocks and inline code spans of a markdown comment, so that commands quoted as
+// examples, e.g. "```\ndigger apply\n```", are not run. Unterminated fences run to the end of the comment as
+// GitHub renders them.
+func StripCode(comment string) string {
+	var lines []string
+	fence := ""
+	for _, line := range strings.Split(comment, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return inlineCodeRegexp.ReplaceAllString(strings.Join(lines, "\n"), "")
+}
+
 func ParseWorkspace(comment string) (string, error) {
 	re := regexp.MustCompile(`-w(?:\s+(\S+)|$)`)
 	matches := re.FindAllStringSubmatch(comment, -1)
@@ -32,3 +66,159 @@ func ParseProjectName(comment string) string {
 	}
 	return ""
 }
+
+// ParseProjectGroup returns the project group or directory selected with "group:<name>", e.g. "digger plan group:networking"
+func ParseProjectGroup(comment string) string {
+	re := regexp.MustCompile(`(?:^|\s)group:([0-9a-zA-Z\-_./]+)`)
+	match := re.FindStringSubmatch(comment)
+	if len(match) > 1 {
+		return match[1]
+	}
+	return ""
+}
+
+// ParseTags returns the tags selected with -tag/--tag flags, repeated or comma separated, and whether projects must
+// carry all of them (-all-tags flag) rather than any of them
+func ParseTags(comment string) ([]string, bool) {
+	re := regexp.MustCompile(`(?:^|\s)--?tag(?:\s+|=)(\S+)`)
+	var tags []string
+	for _, match := range re.FindAllStringSubmatch(comment, -1) {
+		for _, tag := range strings.Split(match[1], ",") {
+			if tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	matchAll := regexp.MustCompile(`(?:^|\s)--?all-tags(?:\s|$)`).MatchString(comment)
+	return tags, matchAll
+}
+
+// ParseCommandVariables returns the env vars given as a JSON object at the end of the command line of a comment, e.g.
+// `digger plan {"var":{"region":"eu"},"env":{"TF_LOG":"debug"}}`. Terraform variables under "var" are returned as
+// TF_VAR_<name> env vars, values which aren't strings are passed JSON encoded as terraform expects for complex types.
+// Comments without a JSON object return no env vars.
+func ParseCommandVariables(comment string) (map[string]string, error) {
+	// braces on later lines or in code blocks, e.g. quoted HCL, aren't variables
+	line := commandLine(StripCode(comment))
+	start := strings.Index(line, "{")
+	if start == -1 {
+		return nil, nil
+	}
+	var overrides map[string]map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(strings.TrimSpace(line[start:])), &overrides); err != nil {
+		return nil, fmt.Errorf("invalid JSON variables in command, expected e.g. {\"var\":{\"region\":\"eu\"}}: %v", err)
+	}
+	envVars := make(map[string]string)
+	for key, values := range overrides {
+		var prefix string
+		switch key {
+		case "var":
+			prefix = "TF_VAR_"
+		case "env":
+		default:
+			return nil, fmt.Errorf("unsupported key %q in command variables, only \"var\" and \"env\" are supported", key)
+		}
+		for name, rawValue := range values {
+			var value string
+			if err := json.Unmarshal(rawValue, &value); err != nil {
+				value = string(rawValue)
+			}
+			envVars[prefix+name] = value
+		}
+	}
+	return envVars, nil
+}
+
+// GlobalFlags are the flags of a command comment applying to all its jobs, e.g. "digger plan -no-color"
+type GlobalFlags struct {
+	// NoColor is set by -no-color, terraform output is produced without color codes
+	NoColor bool
+	// Verbose is set by -verbose, runners log more details
+	Verbose bool
+}
+
+// flagsWithValue are the project targeting flags, their value follows as the next word or after "="
+var flagsWithValue = map[string]bool{"-p": true, "-w": true, "-tag": true}
+
+// ParseGlobalFlags returns the global flags of the command line of a comment, its first line. Project targeting flags
+// (-p, -w, -tag, -all-tags) are skipped, any other flag is an error so that typos don't go unnoticed. Flags can be
+// given with one or two dashes.
+func ParseGlobalFlags(comment string) (GlobalFlags, error) {
+	var flags GlobalFlags
+	commandLine := commandLine(comment)
+	// command variables are JSON, see ParseCommandVariables
+	if start := strings.Index(commandLine, "{"); start != -1 {
+		commandLine = commandLine[:start]
+	}
+	fields := strings.Fields(commandLine)
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		if !strings.HasPrefix(field, "-") || strings.Trim(field, "-") == "" {
+			continue
+		}
+		name, _, hasValue := strings.Cut(field, "=")
+		name = "-" + strings.TrimLeft(name, "-")
+		switch {
+		case name == "-no-color":
+			flags.NoColor = true
+		case name == "-verbose":
+			flags.Verbose = true
+		case name == "-all-tags":
+		case flagsWithValue[name]:
+			if !hasValue {
+				i++
+			}
+		default:
+			return GlobalFlags{}, fmt.Errorf("unknown flag %v, supported flags are -p, -w, -tag, -all-tags, -no-color and -verbose", field)
+		}
+	}
+	return flags, nil
+}
+
+// commandLine returns the first line of a comment, the one holding the command and its flags
+func commandLine(comment string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(comment), "\n")
+	return line
+}
+
+// DefaultSkipToken in a commit message, like "[skip ci]", tells digger not to run for the commit
+const DefaultSkipToken = "[skip digger]"
+
+// ShouldSkip reports whether a commit message contains DefaultSkipToken, ignoring case
+func ShouldSkip(commitMessage string) bool {
+	return ShouldSkipWithToken(commitMessage, DefaultSkipToken)
+}
+
+// ShouldSkipWithToken is ShouldSkip with a custom token, an empty token never skips
+func ShouldSkipWithToken(commitMessage string, token string) bool {
+	if token == "" {
+		return false
+	}
+	return strings.Contains(strings.ToLower(commitMessage), strings.ToLower(token))
+}
+
+// PullRequestDirectives are the settings given in a pull request description with "/digger <directive>" lines
+type PullRequestDirectives struct {
+	// Skip is set by "/digger skip", no job should run for the pull request
+	Skip bool
+	// Projects are the projects named with "/digger project <name>", the pull request should only run for them
+	Projects []string
+}
+
+// ParsePullRequestDirectives extracts the recognized directives from a pull request description, unknown ones are ignored
+func ParsePullRequestDirectives(body string) PullRequestDirectives {
+	var directives PullRequestDirectives
+	for _, line := range strings.Split(body, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.ToLower(fields[0]) != "/digger" {
+			continue
+		}
+		switch strings.ToLower(fields[1]) {
+		case "skip":
+			directives.Skip = true
+		case "project":
+			directives.Projects = append(directives.Projects, fields[2:]...)
+		}
+	}
+	return directives
+}
@@ -0,0 +1,98 @@
+package orchestrator
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseTags(t *testing.T) {
+	tags, matchAll := ParseTags("digger plan -tag prod")
+	assert.Equal(t, []string{"prod"}, tags)
+	assert.False(t, matchAll)
+
+	tags, matchAll = ParseTags("digger plan --tag prod,eu -tag=network -all-tags")
+	assert.Equal(t, []string{"prod", "eu", "network"}, tags)
+	assert.True(t, matchAll)
+
+	tags, _ = ParseTags("digger plan -p tagged-project")
+	assert.Empty(t, tags)
+}
+
+func TestParsePullRequestDirectives(t *testing.T) {
+	directives := ParsePullRequestDirectives("Bump the provider version\r\n\r\n/digger skip\r\n")
+	assert.True(t, directives.Skip)
+	assert.Empty(t, directives.Projects)
+
+	directives = ParsePullRequestDirectives("/digger project vpc\n/Digger PROJECT DNS app\n/digger unknown\nnot /digger skip")
+	assert.False(t, directives.Skip)
+	assert.Equal(t, []string{"vpc", "DNS", "app"}, directives.Projects)
+}
+
+func TestParseCommandVariables(t *testing.T) {
+	envVars, err := ParseCommandVariables(`digger plan -p vpc {"var":{"region":"eu","zones":["a","b"],"count":2},"env":{"TF_LOG":"debug"}}`)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"TF_VAR_region": "eu",
+		"TF_VAR_zones":  `["a","b"]`,
+		"TF_VAR_count":  "2",
+		"TF_LOG":        "debug",
+	}, envVars)
+
+	envVars, err = ParseCommandVariables("digger plan")
+	assert.NoError(t, err)
+	assert.Empty(t, envVars)
+
+	_, err = ParseCommandVariables(`digger plan {"var":{"region":"eu"}`)
+	assert.ErrorContains(t, err, "invalid JSON variables")
+
+	_, err = ParseCommandVariables(`digger plan {"vars":{"region":"eu"}}`)
+	assert.ErrorContains(t, err, `unsupported key "vars"`)
+}
+
+func TestParseCommandVariablesIgnoresLaterLines(t *testing.T) {
+	envVars, err := ParseCommandVariables("digger plan -p vpc\nthe module now reads `var.tags = { team = \"infra\" }`")
+	assert.NoError(t, err)
+	assert.Empty(t, envVars)
+
+	envVars, err = ParseCommandVariables("digger plan\n```hcl\nvariable \"region\" {\n  default = \"eu\"\n}\n```")
+	assert.NoError(t, err)
+	assert.Empty(t, envVars)
+
+	envVars, err = ParseCommandVariables("digger plan {\"var\":{\"region\":\"eu\"}}\n```hcl\nlocals {}\n```")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"TF_VAR_region": "eu"}, envVars)
+}
+
+func TestStripCode(t *testing.T) {
+	assert.Equal(t, "", StripCode("```\ndigger apply\n```"))
+	assert.Equal(t, "digger plan -p dev\nrun ", StripCode("digger plan -p dev\n~~~sh\ndigger apply -p prod\n~~~\nrun `digger apply`"))
+	assert.Equal(t, "see below", StripCode("see below\n```\ndigger apply"))
+}
+
+func TestParseGlobalFlags(t *testing.T) {
+	flags, err := ParseGlobalFlags("digger plan -p dev -no-color -w staging --verbose -tag=networking -all-tags {\"var\":{\"x\":\"-y\"}}")
+	assert.NoError(t, err)
+	assert.Equal(t, GlobalFlags{NoColor: true, Verbose: true}, flags)
+	assert.Equal(t, "dev", ParseProjectName("digger plan -p dev -no-color -w staging"))
+	workspace, err := ParseWorkspace("digger plan -p dev -no-color -w staging")
+	assert.NoError(t, err)
+	assert.Equal(t, "staging", workspace)
+
+	flags, err = ParseGlobalFlags("digger plan -p -dev\n- the second line isn't parsed -like this")
+	assert.NoError(t, err)
+	assert.Equal(t, GlobalFlags{}, flags)
+
+	_, err = ParseGlobalFlags("digger plan -no-colour")
+	assert.ErrorContains(t, err, "unknown flag -no-colour")
+}
+
+func TestShouldSkip(t *testing.T) {
+	assert.True(t, ShouldSkip("Bump module versions [skip digger]"))
+	assert.True(t, ShouldSkip("Fix typo\n\n[Skip Digger]"))
+	assert.False(t, ShouldSkip("Bump module versions [skip ci]"))
+	assert.False(t, ShouldSkip(""))
+
+	assert.True(t, ShouldSkipWithToken("docs only [no-plan]", "[no-plan]"))
+	assert.False(t, ShouldSkipWithToken("docs only [skip digger]", "[no-plan]"))
+	assert.False(t, ShouldSkipWithToken("docs only", ""))
+}
@@ -0,0 +1,37 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	configuration "github.com/diggerhq/lib-digger-config"
+)
+
+// ErrWorkflowNotFound is returned when converting events for a project whose workflow isn't configured
+var ErrWorkflowNotFound = errors.New("workflow not found")
+
+// WithFallbackWorkflow returns a copy of workflows where the missing workflows of projects are replaced by the
+// fallback workflow, so that converting events doesn't fail with ErrWorkflowNotFound. Jobs keep the workflow name of
+// their project but run the stages of the fallback. An empty fallback returns workflows unchanged, i.e. conversion
+// stays strict.
+func WithFallbackWorkflow(projects []configuration.Project, workflows map[string]configuration.Workflow, fallback string) (map[string]configuration.Workflow, error) {
+	if fallback == "" {
+		return workflows, nil
+	}
+	fallbackWorkflow, ok := workflows[fallback]
+	if !ok {
+		return nil, fmt.Errorf("%w: fallback workflow '%s'", ErrWorkflowNotFound, fallback)
+	}
+	result := make(map[string]configuration.Workflow, len(workflows))
+	for name, workflow := range workflows {
+		result[name] = workflow
+	}
+	for _, project := range projects {
+		if _, ok := result[project.Workflow]; !ok {
+			log.Printf("warning: workflow '%s' of project '%s' not found, using fallback workflow '%s'", project.Workflow, project.Name, fallback)
+			result[project.Workflow] = fallbackWorkflow
+		}
+	}
+	return result, nil
+}
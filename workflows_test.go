@@ -0,0 +1,29 @@
+package orchestrator
+
+import (
+	"testing"
+
+	configuration "github.com/diggerhq/lib-digger-config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithFallbackWorkflow(t *testing.T) {
+	projects := []configuration.Project{{Name: "dev", Workflow: "dev"}, {Name: "prod", Workflow: "missing"}}
+	workflows := map[string]configuration.Workflow{
+		"dev":     {EnvVars: &configuration.TerraformEnvConfig{}},
+		"default": {},
+	}
+
+	strict, err := WithFallbackWorkflow(projects, workflows, "")
+	assert.NoError(t, err)
+	assert.Len(t, strict, 2)
+
+	resolved, err := WithFallbackWorkflow(projects, workflows, "default")
+	assert.NoError(t, err)
+	assert.Equal(t, workflows["default"], resolved["missing"])
+	assert.Equal(t, workflows["dev"], resolved["dev"])
+	assert.NotContains(t, workflows, "missing")
+
+	_, err = WithFallbackWorkflow(projects, workflows, "unknown")
+	assert.ErrorIs(t, err, ErrWorkflowNotFound)
+}